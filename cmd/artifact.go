@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thedataflows/etcd2s3/pkg/compression"
+	"github.com/thedataflows/etcd2s3/pkg/manifest"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// compressArtifact compresses a snapshot or export file and removes the original.
+// It returns the path of the file to keep, which is the input path when algorithm is none.
+func compressArtifact(path, algorithm string) (string, error) {
+	if strings.ToLower(algorithm) == "none" || algorithm == "" {
+		return path, nil
+	}
+
+	compressedPath := path + compression.GetCompressionExt(algorithm)
+
+	// Time the compression operation
+	compressionStart := time.Now()
+	if err := compression.CompressFile(path, compressedPath, algorithm); err != nil {
+		return "", fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+
+	log.Logger.Info().Str(log.KEY_PKG, PKG_CMD).Str("algorithm", algorithm).Str("file", compressedPath).Str("duration", fmt.Sprintf("%s", time.Since(compressionStart))).Msg("File compressed")
+
+	// Remove original uncompressed file
+	if err := os.Remove(path); err != nil {
+		log.Logger.Error().Err(err).Str(log.KEY_PKG, PKG_CMD).Str("file", path).Msg("Failed to remove original file")
+	}
+
+	return compressedPath, nil
+}
+
+// fetchArtifact resolves a local path, s3:// URL or S3 key into a local uncompressed file.
+// A .db name that does not exist also matches its compressed versions, like restore.
+// Downloaded and decompressed files are written to workDir.
+func fetchArtifact(ctx *CLIContext, source, workDir string) (string, error) {
+	path, _, err := fetchStoredArtifact(ctx, source, workDir)
+	if err != nil {
+		return "", err
+	}
+	return decompressArtifact(path, workDir)
+}
+
+// decompressArtifact decompresses a compressed file into workDir and returns the new path.
+// Uncompressed files are returned as is.
+func decompressArtifact(path, workDir string) (string, error) {
+	if !compression.IsCompressed(path) {
+		return path, nil
+	}
+
+	decompressedPath := filepath.Join(workDir, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	if err := compression.DecompressFile(path, decompressedPath); err != nil {
+		return "", fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+	return decompressedPath, nil
+}
+
+// fetchStoredArtifact resolves a source like fetchArtifact but does not decompress it.
+// It returns the local path and, for downloaded files, the S3 key it was downloaded from.
+func fetchStoredArtifact(ctx *CLIContext, source, workDir string) (string, string, error) {
+	path, found := "", false
+	if info, err := os.Stat(source); err == nil && !info.IsDir() {
+		path, found = source, true
+	} else if !strings.HasPrefix(source, "s3://") {
+		path, found = compression.ResolveCompressedFile(source)
+	}
+
+	if found {
+		log.Infof(PKG_CMD, "Using local file: %s", path)
+		return path, "", nil
+	}
+
+	s3Client, err := ctx.GetS3Client()
+	if err != nil {
+		return "", "", err
+	}
+
+	// Strip the scheme and bucket from s3:// URLs, the key is relative to the configured prefix
+	key := source
+	if strings.HasPrefix(key, "s3://") {
+		key = key[len("s3://"):]
+		if idx := strings.Index(key, "/"); idx > 0 {
+			key = key[idx+1:]
+		}
+	}
+
+	resolvedKey, found, err := s3Client.ResolveCompressedKey(context.Background(), key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve %s in S3: %w", key, err)
+	}
+	if !found {
+		return "", "", fmt.Errorf("%s not found locally or in S3", source)
+	}
+
+	path = filepath.Join(workDir, filepath.Base(resolvedKey))
+	log.Infof(PKG_CMD, "Downloading s3://%s/%s", ctx.Config.S3.Bucket, resolvedKey)
+	if err := s3Client.Download(context.Background(), resolvedKey, path); err != nil {
+		return "", "", fmt.Errorf("failed to download %s from S3: %w", resolvedKey, err)
+	}
+	return path, resolvedKey, nil
+}
+
+// loadArtifactManifest reads the manifest of a local snapshot, or of a snapshot downloaded
+// from key, as returned by fetchStoredArtifact
+func loadArtifactManifest(ctx *CLIContext, storedPath, key string) (*manifest.Manifest, error) {
+	if key == "" {
+		return manifest.Load(manifest.Name(storedPath))
+	}
+
+	s3Client, err := ctx.GetS3Client()
+	if err != nil {
+		return nil, err
+	}
+	data, err := s3Client.ReadObject(context.Background(), manifest.Name(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return manifest.Parse(data)
+}
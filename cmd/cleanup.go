@@ -16,13 +16,17 @@ type CleanupCmd struct {
 }
 
 func (c *CleanupCmd) Run(ctx *CLIContext) error {
+	return ctx.ForEachCluster(c.run)
+}
+
+func (c *CleanupCmd) run(ctx *CLIContext) error {
 	if c.DryRun {
 		log.Info(PKG_CMD, "Starting cleanup operation (DRY RUN)")
 	} else {
 		log.Info(PKG_CMD, "Starting cleanup operation")
 	}
 
-	retentionManager := retention.NewManager(ctx.Config.Policy)
+	retentionManager := ctx.GetRetentionManager()
 
 	// Use unified approach if both local and S3 are being cleaned
 	if c.Unified && !c.Local && !c.Remote {
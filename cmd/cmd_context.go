@@ -1,16 +1,20 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 
 	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	"github.com/thedataflows/etcd2s3/pkg/retention"
 	"github.com/thedataflows/etcd2s3/pkg/s3"
+	log "github.com/thedataflows/go-lib-log"
 )
 
 // CLIContext holds shared context for commands with S3 client caching
 type CLIContext struct {
 	Version   string
+	Cluster   string
 	Config    *appconfig.AppConfig
 	s3Factory *s3.ClientFactory
 	s3Client  *s3.Client
@@ -55,3 +59,50 @@ func (ctx *CLIContext) GetS3ClientOrNil() *s3.Client {
 func (ctx *CLIContext) GetS3Factory() *s3.ClientFactory {
 	return ctx.s3Factory
 }
+
+// GetRetentionManager returns a retention manager with the local and S3 policies
+func (ctx *CLIContext) GetRetentionManager() *retention.Manager {
+	return retention.NewManager(ctx.Config.LocalRetention(), ctx.Config.RemoteRetention()).
+		WithNameLayout(ctx.Config.Etcd.SnapshotNameLayout)
+}
+
+// ForEachCluster runs fn once per selected cluster with a context scoped to that cluster.
+// Without a clusters file fn runs once with this context. All clusters are attempted
+// even if some fail; the errors are joined.
+func (ctx *CLIContext) ForEachCluster(fn func(*CLIContext) error) error {
+	clusters := ctx.Config.SelectedClusters()
+	if len(clusters) == 0 {
+		return fn(ctx)
+	}
+
+	var errs []error
+	for _, cluster := range clusters {
+		log.Logger.Info().Str(log.KEY_PKG, PKG_CMD).Str("cluster", cluster.Name).Msg("Processing cluster")
+		if err := fn(ctx.forCluster(cluster)); err != nil {
+			log.Logger.Error().Err(err).Str(log.KEY_PKG, PKG_CMD).Str("cluster", cluster.Name).Msg("Cluster failed")
+			errs = append(errs, fmt.Errorf("cluster %s: %w", cluster.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SingleCluster returns a context scoped to the one selected cluster.
+// Without a clusters file it returns this context.
+func (ctx *CLIContext) SingleCluster() (*CLIContext, error) {
+	clusters := ctx.Config.SelectedClusters()
+	switch len(clusters) {
+	case 0:
+		return ctx, nil
+	case 1:
+		return ctx.forCluster(clusters[0]), nil
+	default:
+		return nil, fmt.Errorf("this command operates on a single cluster, select one with --cluster")
+	}
+}
+
+// forCluster returns a new context scoped to the given cluster with its own S3 client cache
+func (ctx *CLIContext) forCluster(cluster appconfig.ClusterConfig) *CLIContext {
+	scoped := NewCLIContext(ctx.Version, ctx.Config.ForCluster(cluster))
+	scoped.Cluster = cluster.Name
+	return scoped
+}
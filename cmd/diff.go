@@ -0,0 +1,396 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	"github.com/thedataflows/etcd2s3/pkg/snapshotdb"
+	log "github.com/thedataflows/go-lib-log"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+// Key change types reported by diff
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// liveSource names the live cluster in diff reports
+const liveSource = "live cluster"
+
+// DiffCmd compares two snapshots, or a snapshot with the live cluster
+type DiffCmd struct {
+	From   string `kong:"arg,required,help='Snapshot to compare from (local path, s3:// URL or S3 key)'"`
+	To     string `kong:"arg,optional,help='Snapshot to compare to, the live cluster when omitted'"`
+	Prefix string `kong:"help='Only compare keys with this prefix'"`
+	Depth  int    `kong:"help='Number of key path segments that make up a prefix in the summary',default='2'"`
+	Values bool   `kong:"help='Show a diff of modified values'"`
+	Format string `kong:"help='Output format (table,json)',default='table',enum='table,json'"`
+}
+
+// DiffReport describes the differences between two keyspaces
+type DiffReport struct {
+	From         string       `json:"from"`
+	FromRevision int64        `json:"from_revision"`
+	To           string       `json:"to"`
+	ToRevision   int64        `json:"to_revision"`
+	Added        int          `json:"added"`
+	Removed      int          `json:"removed"`
+	Modified     int          `json:"modified"`
+	Prefixes     []PrefixDiff `json:"prefixes"`
+	Changes      []KeyChange  `json:"changes"`
+}
+
+// PrefixDiff summarizes the changes under a prefix
+type PrefixDiff struct {
+	Prefix   string `json:"prefix"`
+	Added    int    `json:"added"`
+	Removed  int    `json:"removed"`
+	Modified int    `json:"modified"`
+}
+
+// KeyChange is a key that differs between the two keyspaces
+type KeyChange struct {
+	Type            string `json:"type"`
+	Key             string `json:"key"`
+	FromModRevision int64  `json:"from_mod_revision,omitempty"`
+	ToModRevision   int64  `json:"to_mod_revision,omitempty"`
+	Diff            string `json:"diff,omitempty"`
+}
+
+func (d *DiffCmd) Run(ctx *CLIContext) error {
+	ctx, err := ctx.SingleCluster()
+	if err != nil {
+		return err
+	}
+
+	workDir, err := os.MkdirTemp("", "etcd2s3-diff-")
+	if err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	report, err := d.diff(ctx, workDir)
+	if err != nil {
+		return err
+	}
+
+	switch d.Format {
+	case "json":
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal report to JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	default:
+		return d.outputTable(report)
+	}
+}
+
+// diff reads the keys of both keyspaces and compares them by value hash. Values are only
+// read again for the modified keys when --values is set.
+func (d *DiffCmd) diff(ctx *CLIContext, workDir string) (*DiffReport, error) {
+	fromPath, err := d.fetchSnapshot(ctx, d.From, filepath.Join(workDir, "from"))
+	if err != nil {
+		return nil, err
+	}
+	fromStats, fromRevision, err := d.snapshotStats(fromPath)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DiffReport{From: d.From, FromRevision: fromRevision, To: d.To}
+	var toPath string
+	var toStats []snapshotdb.KeyStat
+	if d.To == "" {
+		report.To = liveSource
+		toStats, report.ToRevision, err = d.liveStats(ctx)
+	} else {
+		toPath, err = d.fetchSnapshot(ctx, d.To, filepath.Join(workDir, "to"))
+		if err == nil {
+			toStats, report.ToRevision, err = d.snapshotStats(toPath)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report.Changes = diffKeys(fromStats, toStats)
+	if d.Values {
+		if err := d.valueDiffs(ctx, report, fromPath, toPath); err != nil {
+			return nil, err
+		}
+	}
+	report.Prefixes = prefixDiffs(report.Changes, d.Depth)
+	for _, prefix := range report.Prefixes {
+		report.Added += prefix.Added
+		report.Removed += prefix.Removed
+		report.Modified += prefix.Modified
+	}
+
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_CMD).Int("added", report.Added).Int("removed", report.Removed).Int("modified", report.Modified).Msg("Diff completed")
+	return report, nil
+}
+
+// fetchSnapshot fetches a snapshot into workDir and returns its uncompressed path
+func (d *DiffCmd) fetchSnapshot(ctx *CLIContext, source, workDir string) (string, error) {
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create work directory: %w", err)
+	}
+	return fetchArtifact(ctx, source, workDir)
+}
+
+// prefixMatch returns a match function for the keys under the prefix, nil for all keys
+func (d *DiffCmd) prefixMatch() func([]byte) bool {
+	if d.Prefix == "" {
+		return nil
+	}
+	prefix := []byte(d.Prefix)
+	return func(key []byte) bool { return bytes.HasPrefix(key, prefix) }
+}
+
+// snapshotStats reads the stats of the live keys under the prefix from a snapshot
+func (d *DiffCmd) snapshotStats(snapshotPath string) ([]snapshotdb.KeyStat, int64, error) {
+	db, err := snapshotdb.Open(snapshotPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer db.Close()
+
+	return db.LatestKeyStats(d.prefixMatch())
+}
+
+// liveStats reads the stats of the keys under the prefix from the live cluster at its
+// current revision
+func (d *DiffCmd) liveStats(ctx *CLIContext) ([]snapshotdb.KeyStat, int64, error) {
+	var stats []snapshotdb.KeyStat
+	revision, err := d.liveRange(ctx, 0, func(kv *mvccpb.KeyValue) {
+		stats = append(stats, snapshotdb.NewKeyStat(kv))
+	})
+	return stats, revision, err
+}
+
+// liveRange calls fn with every key under the prefix in the live cluster at revision,
+// 0 for the current one, and returns the revision read
+func (d *DiffCmd) liveRange(ctx *CLIContext, revision int64, fn func(kv *mvccpb.KeyValue)) (int64, error) {
+	etcdClient, err := etcd.NewClient(ctx.Config.Etcd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create etcd client: %w", err)
+	}
+	defer etcdClient.Close()
+
+	rangeCtx, cancel := context.WithTimeout(context.Background(), ctx.Config.Etcd.SnapshotTimeout)
+	defer cancel()
+
+	result, err := etcdClient.Range(rangeCtx, etcd.ExportOptions{Prefix: d.Prefix, Revision: revision}, func(kv *mvccpb.KeyValue) error {
+		fn(kv)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.Revision, nil
+}
+
+// valueDiffs reads the values of the modified keys from both sides and sets their diffs.
+// An empty toPath reads them from the live cluster at the revision of the report.
+func (d *DiffCmd) valueDiffs(ctx *CLIContext, report *DiffReport, fromPath, toPath string) error {
+	modified := make(map[string]bool)
+	for _, change := range report.Changes {
+		if change.Type == ChangeModified {
+			modified[change.Key] = true
+		}
+	}
+	if len(modified) == 0 {
+		return nil
+	}
+
+	fromValues, err := snapshotValues(fromPath, modified)
+	if err != nil {
+		return err
+	}
+	var toValues map[string]*mvccpb.KeyValue
+	if toPath == "" {
+		toValues = make(map[string]*mvccpb.KeyValue, len(modified))
+		_, err = d.liveRange(ctx, report.ToRevision, func(kv *mvccpb.KeyValue) {
+			if modified[string(kv.Key)] {
+				toValues[string(kv.Key)] = kv
+			}
+		})
+	} else {
+		toValues, err = snapshotValues(toPath, modified)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, change := range report.Changes {
+		from, to := fromValues[change.Key], toValues[change.Key]
+		if change.Type == ChangeModified && from != nil && to != nil {
+			report.Changes[i].Diff = valueDiff(from, to)
+		}
+	}
+	return nil
+}
+
+// snapshotValues reads the latest version of the given keys from a snapshot
+func snapshotValues(snapshotPath string, keys map[string]bool) (map[string]*mvccpb.KeyValue, error) {
+	db, err := snapshotdb.Open(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	kvs, _, err := db.LatestKeys(func(key []byte) bool { return keys[string(key)] })
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]*mvccpb.KeyValue, len(kvs))
+	for _, kv := range kvs {
+		values[string(kv.Key)] = kv
+	}
+	return values, nil
+}
+
+// diffKeys compares two key lists sorted by key. A key is modified when the hash of its
+// value differs; a rewrite with the same value is not reported.
+func diffKeys(from, to []snapshotdb.KeyStat) []KeyChange {
+	var changes []KeyChange
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		var c int
+		switch {
+		case i == len(from):
+			c = 1
+		case j == len(to):
+			c = -1
+		default:
+			c = strings.Compare(from[i].Key, to[j].Key)
+		}
+
+		switch {
+		case c < 0:
+			changes = append(changes, KeyChange{Type: ChangeRemoved, Key: from[i].Key, FromModRevision: from[i].ModRevision})
+			i++
+		case c > 0:
+			changes = append(changes, KeyChange{Type: ChangeAdded, Key: to[j].Key, ToModRevision: to[j].ModRevision})
+			j++
+		default:
+			if from[i].Hash != to[j].Hash {
+				changes = append(changes, KeyChange{Type: ChangeModified, Key: from[i].Key, FromModRevision: from[i].ModRevision, ToModRevision: to[j].ModRevision})
+			}
+			i++
+			j++
+		}
+	}
+	return changes
+}
+
+// valueDiff returns a unified diff of two text values, or a size summary for binary values
+func valueDiff(from, to *mvccpb.KeyValue) string {
+	if !utf8.Valid(from.Value) || !utf8.Valid(to.Value) {
+		return fmt.Sprintf("%s: binary values differ (%s -> %s)\n", from.Key, formatSize(int64(len(from.Value))), formatSize(int64(len(to.Value))))
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(from.Value)),
+		B:        difflib.SplitLines(string(to.Value)),
+		FromFile: fmt.Sprintf("%s@%d", from.Key, from.ModRevision),
+		ToFile:   fmt.Sprintf("%s@%d", to.Key, to.ModRevision),
+		Context:  3,
+	})
+	if err != nil {
+		return fmt.Sprintf("failed to diff values: %v\n", err)
+	}
+	return diff
+}
+
+// prefixDiffs aggregates changes by prefix, most changes first
+func prefixDiffs(changes []KeyChange, depth int) []PrefixDiff {
+	byPrefix := make(map[string]*PrefixDiff)
+	for _, change := range changes {
+		prefix := snapshotdb.Prefix(change.Key, depth)
+		summary, ok := byPrefix[prefix]
+		if !ok {
+			summary = &PrefixDiff{Prefix: prefix}
+			byPrefix[prefix] = summary
+		}
+		switch change.Type {
+		case ChangeAdded:
+			summary.Added++
+		case ChangeRemoved:
+			summary.Removed++
+		case ChangeModified:
+			summary.Modified++
+		}
+	}
+
+	result := make([]PrefixDiff, 0, len(byPrefix))
+	for _, summary := range byPrefix {
+		result = append(result, *summary)
+	}
+	total := func(p PrefixDiff) int { return p.Added + p.Removed + p.Modified }
+	slices.SortFunc(result, func(a, b PrefixDiff) int {
+		return cmp.Or(cmp.Compare(total(b), total(a)), cmp.Compare(a.Prefix, b.Prefix))
+	})
+	return result
+}
+
+func (d *DiffCmd) outputTable(report *DiffReport) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintf(w, "From:\t%s (revision %d)\n", report.From, report.FromRevision)
+	_, _ = fmt.Fprintf(w, "To:\t%s (revision %d)\n", report.To, report.ToRevision)
+	_, _ = fmt.Fprintf(w, "Changes:\t%d added, %d removed, %d modified\n", report.Added, report.Removed, report.Modified)
+	if len(report.Changes) == 0 {
+		return w.Flush()
+	}
+	_, _ = fmt.Fprintln(w)
+
+	_, _ = fmt.Fprintln(w, "PREFIX\tADDED\tREMOVED\tMODIFIED")
+	for _, prefix := range report.Prefixes {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", prefix.Prefix, prefix.Added, prefix.Removed, prefix.Modified)
+	}
+	_, _ = fmt.Fprintln(w)
+
+	_, _ = fmt.Fprintln(w, "CHANGE\tKEY\tFROM REVISION\tTO REVISION")
+	for _, change := range report.Changes {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", change.Type, change.Key, formatRevision(change.FromModRevision), formatRevision(change.ToModRevision))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	// Value diffs span several lines and are printed after the table
+	for _, change := range report.Changes {
+		if change.Diff != "" {
+			fmt.Println()
+			fmt.Print(change.Diff)
+			if !strings.HasSuffix(change.Diff, "\n") {
+				fmt.Println()
+			}
+		}
+	}
+	return nil
+}
+
+// formatRevision prints a mod revision, or a dash for a key missing on that side
+func formatRevision(revision int64) string {
+	if revision == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d", revision)
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+)
+
+func TestDiff(tMain *testing.T) {
+	srv := etcdtest.Start(tMain, etcdtest.Config{})
+	srv.PutKeys(tMain, map[string]string{
+		"/registry/configmaps/default/app": "line1\nline2\n",
+		"/registry/configmaps/default/old": "old",
+		"/registry/pods/default/web":       "web",
+	})
+
+	ctx := newTestCLIContext(tMain, srv)
+	require.NoError(tMain, (&SnapshotCmd{Name: "before", Compression: "zstd"}).Run(ctx))
+
+	srv.PutKeys(tMain, map[string]string{
+		"/registry/configmaps/default/app": "line1\nchanged\n",
+		"/registry/configmaps/default/new": "new",
+		"/registry/pods/default/web":       "web",
+	})
+	_, err := srv.Client(tMain).Delete(context.Background(), "/registry/configmaps/default/old")
+	require.NoError(tMain, err)
+	require.NoError(tMain, (&SnapshotCmd{Name: "after", Compression: "gzip"}).Run(ctx))
+
+	before := filepath.Join(ctx.Config.Etcd.SnapshotDir, "before.db")
+	after := filepath.Join(ctx.Config.Etcd.SnapshotDir, "after.db")
+
+	tests := []struct {
+		name     string
+		cmd      DiffCmd
+		expected []KeyChange
+	}{
+		{
+			name: "two snapshots",
+			cmd:  DiffCmd{From: before, To: after, Depth: 2},
+			expected: []KeyChange{
+				{Type: ChangeModified, Key: "/registry/configmaps/default/app"},
+				{Type: ChangeAdded, Key: "/registry/configmaps/default/new"},
+				{Type: ChangeRemoved, Key: "/registry/configmaps/default/old"},
+			},
+		},
+		{
+			name: "snapshot against live cluster",
+			cmd:  DiffCmd{From: before, Depth: 2},
+			expected: []KeyChange{
+				{Type: ChangeModified, Key: "/registry/configmaps/default/app"},
+				{Type: ChangeAdded, Key: "/registry/configmaps/default/new"},
+				{Type: ChangeRemoved, Key: "/registry/configmaps/default/old"},
+			},
+		},
+		{
+			name: "outside the prefix",
+			cmd:  DiffCmd{From: before, To: after, Prefix: "/registry/pods/", Depth: 2},
+		},
+		{
+			name: "identical snapshots",
+			cmd:  DiffCmd{From: after, To: after, Depth: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		tMain.Run(tt.name, func(t *testing.T) {
+			report, err := tt.cmd.diff(ctx, t.TempDir())
+			require.NoError(t, err)
+
+			require.Len(t, report.Changes, len(tt.expected))
+			for i, change := range report.Changes {
+				assert.Equal(t, tt.expected[i].Type, change.Type)
+				assert.Equal(t, tt.expected[i].Key, change.Key)
+				assert.Empty(t, change.Diff)
+			}
+			assert.Equal(t, len(tt.expected), report.Added+report.Removed+report.Modified)
+			if len(tt.expected) > 0 {
+				assert.Equal(t, []PrefixDiff{{Prefix: "/registry/configmaps/", Added: 1, Removed: 1, Modified: 1}}, report.Prefixes)
+				assert.Less(t, report.FromRevision, report.ToRevision)
+			}
+		})
+	}
+
+	tMain.Run("value diff", func(t *testing.T) {
+		report, err := (&DiffCmd{From: before, To: after, Prefix: "/registry/configmaps/default/app", Values: true}).diff(ctx, t.TempDir())
+		require.NoError(t, err)
+		require.Len(t, report.Changes, 1)
+		assert.Contains(t, report.Changes[0].Diff, "-line2\n+changed\n")
+		assert.Contains(t, report.Changes[0].Diff, "--- /registry/configmaps/default/app@")
+	})
+
+	tMain.Run("value diff against live cluster", func(t *testing.T) {
+		report, err := (&DiffCmd{From: before, Prefix: "/registry/configmaps/", Values: true}).diff(ctx, t.TempDir())
+		require.NoError(t, err)
+		require.Len(t, report.Changes, 3)
+		assert.Contains(t, report.Changes[0].Diff, "-line2\n+changed\n")
+		assert.Empty(t, report.Changes[1].Diff, "added keys have no value diff")
+	})
+}
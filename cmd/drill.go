@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/embedded"
+	"github.com/thedataflows/etcd2s3/pkg/manifest"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// DrillCmd restores a snapshot into a scratch member, boots it and checks the result
+type DrillCmd struct {
+	Source     string    `kong:"arg,optional,default='latest',help='Snapshot source (local path, s3:// URL, S3 key or latest)'"`
+	At         time.Time `kong:"help='Drill the newest snapshot taken at or before this time, RFC 3339'"`
+	MinKeys    []string  `kong:"help='Require at least N keys under a prefix, prefix=N, repeatable',sep='none'"`
+	RequireKey []string  `kong:"help='Require a key to exist, repeatable',sep='none'"`
+	Output     string    `kong:"help='Write the JSON report to this file instead of stdout'"`
+}
+
+// DrillReport is the outcome of a restore drill
+type DrillReport struct {
+	Cluster        string       `json:"cluster,omitempty"`
+	Snapshot       string       `json:"snapshot"`
+	StartedAt      time.Time    `json:"started_at"`
+	Passed         bool         `json:"passed"`
+	Revision       int64        `json:"revision,omitempty"`
+	Keys           int64        `json:"keys,omitempty"`
+	FetchSeconds   float64      `json:"fetch_seconds"`
+	RestoreSeconds float64      `json:"restore_seconds"`
+	StartSeconds   float64      `json:"start_seconds"`
+	TotalSeconds   float64      `json:"total_seconds"`
+	Checks         []DrillCheck `json:"checks"`
+	Error          string       `json:"error,omitempty"`
+}
+
+// DrillCheck is the result of a single drill check
+type DrillCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// check records the result of a check
+func (r *DrillReport) check(name string, passed bool, format string, args ...any) {
+	r.Checks = append(r.Checks, DrillCheck{Name: name, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (d *DrillCmd) Run(ctx *CLIContext) error {
+	ctx, err := ctx.SingleCluster()
+	if err != nil {
+		return err
+	}
+
+	if !d.At.IsZero() && d.Source != "" && d.Source != sourceLatest {
+		return fmt.Errorf("--at selects the snapshot, do not pass a source")
+	}
+
+	minKeys, err := parseMinKeys(d.MinKeys)
+	if err != nil {
+		return err
+	}
+
+	workDir, err := os.MkdirTemp("", "etcd2s3-drill-")
+	if err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	report := &DrillReport{Cluster: ctx.Cluster, Snapshot: d.Source, StartedAt: time.Now().UTC()}
+	if err := d.drill(ctx, workDir, minKeys, report); err != nil {
+		report.Error = err.Error()
+	}
+	report.TotalSeconds = time.Since(report.StartedAt).Seconds()
+
+	report.Passed = report.Error == ""
+	for _, check := range report.Checks {
+		report.Passed = report.Passed && check.Passed
+	}
+
+	if err := d.writeReport(report); err != nil {
+		return err
+	}
+	if !report.Passed {
+		return fmt.Errorf("restore drill of %s failed", report.Snapshot)
+	}
+	log.Infof(PKG_CMD, "Restore drill of %s passed", report.Snapshot)
+	return nil
+}
+
+// drill fetches, verifies, restores and boots the snapshot, recording checks in the report.
+// An error means the drill could not go on; failed checks are only recorded.
+func (d *DrillCmd) drill(ctx *CLIContext, workDir string, minKeys []minKeys, report *DrillReport) error {
+	started := time.Now()
+
+	if d.Source == sourceLatest {
+		source, err := selectSnapshot(ctx, d.At, 0)
+		if err != nil {
+			return fmt.Errorf("failed to select snapshot: %w", err)
+		}
+		report.Snapshot = source
+	}
+
+	storedPath, key, err := fetchStoredArtifact(ctx, report.Snapshot, workDir)
+	if err != nil {
+		return err
+	}
+	m, err := loadArtifactManifest(ctx, storedPath, key)
+	if err != nil {
+		report.check("manifest", false, "%v", err)
+	} else {
+		digest, err := manifest.FileSHA256(storedPath)
+		if err != nil {
+			return err
+		}
+		report.check("sha256", digest == m.SHA256, "stored file %s, manifest %s", digest, m.SHA256)
+	}
+
+	snapshotPath, err := decompressArtifact(storedPath, workDir)
+	if err != nil {
+		return err
+	}
+	report.FetchSeconds = time.Since(started).Seconds()
+
+	status, err := etcd.ReadSnapshotStatus(snapshotPath)
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		report.check("db-hash", status.Hash == m.DBHash, "snapshot %08x, manifest %08x", status.Hash, m.DBHash)
+	}
+
+	// Restore into a scratch single member on loopback
+	peerURL, err := embedded.FreeURL()
+	if err != nil {
+		return err
+	}
+	dataDir := filepath.Join(workDir, "data")
+	restoreStarted := time.Now()
+	err = etcd.RestoreSnapshot(context.Background(), etcd.RestoreOptions{
+		SnapshotPath:             snapshotPath,
+		DataDir:                  dataDir,
+		Name:                     "drill",
+		InitialCluster:           "drill=" + peerURL,
+		InitialAdvertisePeerURLs: []string{peerURL},
+	})
+	report.check("restore", err == nil, "%s", errorDetail(err, "restored"))
+	if err != nil {
+		return nil
+	}
+	report.RestoreSeconds = time.Since(restoreStarted).Seconds()
+
+	startStarted := time.Now()
+	srv, err := embedded.Start(embedded.Config{Name: "drill", DataDir: dataDir, PeerURL: peerURL, UnsafeNoFsync: true})
+	report.check("start", err == nil, "%s", errorDetail(err, "member ready"))
+	if err != nil {
+		return nil
+	}
+	defer srv.Stop()
+	report.StartSeconds = time.Since(startStarted).Seconds()
+
+	client, err := etcd.NewClient(appconfig.EtcdConfig{Endpoints: []string{srv.Endpoint}, SnapshotSource: etcd.StrategyFirst})
+	if err != nil {
+		return fmt.Errorf("failed to connect to drill member: %w", err)
+	}
+	defer client.Close()
+
+	checkCtx := context.Background()
+	if report.Revision, err = client.Revision(checkCtx); err != nil {
+		return err
+	}
+	if report.Keys, err = client.Count(checkCtx, "", true); err != nil {
+		return err
+	}
+	if m != nil {
+		report.check("revision", report.Revision == m.Revision, "restored %d, manifest %d", report.Revision, m.Revision)
+	}
+
+	for _, want := range minKeys {
+		count, err := client.Count(checkCtx, want.Prefix, true)
+		if err != nil {
+			return err
+		}
+		report.check("min-keys "+want.Prefix, count >= want.Count, "%d keys, at least %d required", count, want.Count)
+	}
+	for _, key := range d.RequireKey {
+		count, err := client.Count(checkCtx, key, false)
+		if err != nil {
+			return err
+		}
+		detail := "present"
+		if count == 0 {
+			detail = "missing"
+		}
+		report.check("require-key "+key, count == 1, "%s", detail)
+	}
+
+	return nil
+}
+
+// writeReport writes the JSON report to --output or stdout
+func (d *DrillCmd) writeReport(report *DrillReport) error {
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report to JSON: %w", err)
+	}
+
+	if d.Output == "" {
+		fmt.Println(string(out))
+		return nil
+	}
+	if err := os.WriteFile(d.Output, append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	log.Infof(PKG_CMD, "Drill report written to %s", d.Output)
+	return nil
+}
+
+// minKeys is a minimum number of keys required under a prefix
+type minKeys struct {
+	Prefix string
+	Count  int64
+}
+
+// parseMinKeys parses prefix=N values
+func parseMinKeys(values []string) ([]minKeys, error) {
+	parsed := make([]minKeys, 0, len(values))
+	for _, value := range values {
+		idx := strings.LastIndex(value, "=")
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid --min-keys %q, expected prefix=N", value)
+		}
+		minimum, err := strconv.ParseInt(value[idx+1:], 10, 64)
+		if err != nil || minimum < 0 {
+			return nil, fmt.Errorf("invalid --min-keys %q, expected prefix=N", value)
+		}
+		parsed = append(parsed, minKeys{Prefix: value[:idx], Count: minimum})
+	}
+	return parsed, nil
+}
+
+// errorDetail returns the error message, or ok when there is no error
+func errorDetail(err error, ok string) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ok
+}
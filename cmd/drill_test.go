@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+)
+
+func TestDrill(tMain *testing.T) {
+	srv := etcdtest.Start(tMain, etcdtest.Config{})
+	srv.PutKeys(tMain, map[string]string{
+		"/registry/pods/a": "pod-a",
+		"/registry/pods/b": "pod-b",
+		"/config/x":        "x",
+	})
+	ctx := newTestCLIContext(tMain, srv)
+	require.NoError(tMain, (&SnapshotCmd{Name: "drill-snapshot", Compression: "zstd"}).Run(ctx))
+
+	tests := []struct {
+		name   string
+		cmd    DrillCmd
+		passed bool
+		failed []string
+	}{
+		{
+			name:   "latest passes",
+			cmd:    DrillCmd{Source: sourceLatest, MinKeys: []string{"/registry/pods/=2"}, RequireKey: []string{"/config/x"}},
+			passed: true,
+		},
+		{
+			name:   "not enough keys",
+			cmd:    DrillCmd{Source: sourceLatest, MinKeys: []string{"/registry/pods/=3"}},
+			failed: []string{"min-keys /registry/pods/"},
+		},
+		{
+			name:   "missing key",
+			cmd:    DrillCmd{Source: "drill-snapshot.db.zst", RequireKey: []string{"/config/y"}},
+			failed: []string{"require-key /config/y"},
+		},
+	}
+
+	for _, tt := range tests {
+		tMain.Run(tt.name, func(t *testing.T) {
+			if tt.cmd.Source != sourceLatest {
+				tt.cmd.Source = filepath.Join(ctx.Config.Etcd.SnapshotDir, tt.cmd.Source)
+			}
+			tt.cmd.Output = filepath.Join(t.TempDir(), "report.json")
+			err := tt.cmd.Run(ctx)
+			if tt.passed {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+
+			data, err := os.ReadFile(tt.cmd.Output)
+			require.NoError(t, err)
+			var report DrillReport
+			require.NoError(t, json.Unmarshal(data, &report))
+
+			assert.Equal(t, tt.passed, report.Passed)
+			assert.Empty(t, report.Error)
+			assert.Equal(t, int64(3), report.Keys)
+			assert.Positive(t, report.Revision)
+
+			var failed []string
+			for _, check := range report.Checks {
+				if !check.Passed {
+					failed = append(failed, check.Name)
+				}
+			}
+			assert.Equal(t, tt.failed, failed)
+			for _, name := range []string{"sha256", "db-hash", "restore", "start", "revision"} {
+				assert.Contains(t, checkNames(report.Checks), name)
+			}
+		})
+	}
+
+	tMain.Run("invalid min-keys", func(t *testing.T) {
+		assert.Error(t, (&DrillCmd{Source: sourceLatest, MinKeys: []string{"/registry"}}).Run(ctx))
+	})
+
+	tMain.Run("source and at", func(t *testing.T) {
+		source := filepath.Join(ctx.Config.Etcd.SnapshotDir, "drill-snapshot.db.zst")
+		assert.ErrorContains(t, (&DrillCmd{Source: source, At: time.Now()}).Run(ctx), "do not pass a source")
+	})
+}
+
+func checkNames(checks []DrillCheck) []string {
+	names := make([]string, 0, len(checks))
+	for _, check := range checks {
+		names = append(names, check.Name)
+	}
+	return names
+}
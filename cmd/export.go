@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// ExportCmd exports a key prefix or range to NDJSON and uploads to S3
+type ExportCmd struct {
+	Name        string `kong:"help='Custom export name',default=''"`
+	Prefix      string `kong:"help='Export all keys with this prefix',xor='range'"`
+	From        string `kong:"help='First key of the range to export (inclusive)',xor='range'"`
+	To          string `kong:"help='End of the range to export (exclusive), default: all keys from --from onward'"`
+	Revision    int64  `kong:"help='Revision to export at (default: current revision)'"`
+	PageSize    int64  `kong:"help='Number of keys fetched per request',default='1000'"`
+	UploadToS3  bool   `kong:"help='Upload export to S3',default=true,name='upload-to-s3'"`
+	RemoveLocal bool   `kong:"help='Remove local export after S3 upload'"`
+	Compression string `kong:"help='Compression algorithm for export',default='zstd',enum='none,bzip2,gzip,lz4,zstd'"`
+}
+
+func (e *ExportCmd) Run(ctx *CLIContext) error {
+	return ctx.ForEachCluster(e.run)
+}
+
+func (e *ExportCmd) run(ctx *CLIContext) error {
+	if e.To != "" && e.From == "" {
+		return fmt.Errorf("--to requires --from")
+	}
+
+	log.Info(PKG_CMD, "Starting export operation")
+
+	etcdClient, err := etcd.NewClient(ctx.Config.Etcd)
+	if err != nil {
+		return fmt.Errorf("failed to create etcd client: %w", err)
+	}
+	defer etcdClient.Close()
+
+	// Generate export name if not provided
+	exportName := e.Name
+	if len(exportName) == 0 {
+		exportName = fmt.Sprintf("etcd-export-%s%s", time.Now().Format("20060102-150405"), etcd.ExportExt)
+	}
+	if !strings.HasSuffix(exportName, etcd.ExportExt) {
+		exportName += etcd.ExportExt
+	}
+
+	if err := os.MkdirAll(ctx.Config.Etcd.SnapshotDir, 0755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	exportPath := filepath.Join(ctx.Config.Etcd.SnapshotDir, exportName)
+
+	exportCtx, cancel := context.WithTimeout(context.Background(), ctx.Config.Etcd.SnapshotTimeout)
+	defer cancel()
+
+	result, err := e.writeExport(exportCtx, etcdClient, exportPath)
+	if err != nil {
+		return err
+	}
+
+	log.Logger.Info().Str(log.KEY_PKG, PKG_CMD).Str("file", exportPath).Int64("revision", result.Revision).Int("keys", result.Keys).Msg("Export saved")
+
+	finalExportPath, err := compressArtifact(exportPath, e.Compression)
+	if err != nil {
+		return fmt.Errorf("failed to compress export: %w", err)
+	}
+
+	if e.UploadToS3 {
+		s3Client, err := ctx.GetS3Client()
+		if err != nil {
+			return err
+		}
+
+		s3Key := filepath.Base(finalExportPath)
+		if err := s3Client.Upload(context.Background(), finalExportPath, s3Key); err != nil {
+			return fmt.Errorf("failed to upload export to S3: %w", err)
+		}
+
+		log.Infof(PKG_CMD, "Export uploaded to S3: s3://%s/%s", ctx.Config.S3.Bucket, s3Key)
+
+		if e.RemoveLocal || ctx.Config.Policy.RemoveLocal {
+			if err := os.Remove(finalExportPath); err != nil {
+				log.Warnf(PKG_CMD, "Failed to remove local export %s: %v", finalExportPath, err)
+			} else {
+				log.Infof(PKG_CMD, "Local export removed: %s", finalExportPath)
+			}
+		}
+	}
+
+	log.Info(PKG_CMD, "Export operation completed successfully")
+	return nil
+}
+
+// writeExport writes the selected keys to a partial file and moves it into place once complete
+func (e *ExportCmd) writeExport(ctx context.Context, etcdClient *etcd.Client, exportPath string) (*etcd.ExportResult, error) {
+	partPath := exportPath + ".part"
+	file, err := os.Create(partPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(partPath)
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	result, err := etcdClient.Export(ctx, writer, etcd.ExportOptions{
+		Prefix:   e.Prefix,
+		From:     e.From,
+		To:       e.To,
+		Revision: e.Revision,
+		PageSize: e.PageSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to export keys: %w", err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write export file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write export file: %w", err)
+	}
+	if err := os.Rename(partPath, exportPath); err != nil {
+		return nil, fmt.Errorf("failed to move export into place: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	"github.com/thedataflows/etcd2s3/pkg/snapshotdb"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// GetCmd reads keys directly out of a snapshot without restoring it
+type GetCmd struct {
+	Source string `kong:"arg,required,help='Snapshot source (local path, s3:// URL or S3 key)'"`
+	Key    string `kong:"arg,required,help='Key to read, or key prefix with --prefix'"`
+	Prefix bool   `kong:"help='Read every key starting with the given key'"`
+	Format string `kong:"help='Output format (raw,json,ndjson)',default='raw',enum='raw,json,ndjson'"`
+}
+
+func (g *GetCmd) Run(ctx *CLIContext) error {
+	ctx, err := ctx.SingleCluster()
+	if err != nil {
+		return err
+	}
+
+	workDir, err := os.MkdirTemp("", "etcd2s3-get-")
+	if err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	snapshotPath, err := fetchArtifact(ctx, g.Source, workDir)
+	if err != nil {
+		return err
+	}
+
+	return g.get(snapshotPath, os.Stdout)
+}
+
+// get writes the matching keys of an uncompressed snapshot to w
+func (g *GetCmd) get(snapshotPath string, w io.Writer) error {
+	db, err := snapshotdb.Open(snapshotPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	key := []byte(g.Key)
+	kvs, revision, err := db.LatestKeys(func(k []byte) bool {
+		if g.Prefix {
+			return bytes.HasPrefix(k, key)
+		}
+		return bytes.Equal(k, key)
+	})
+	if err != nil {
+		return err
+	}
+	if len(kvs) == 0 && !g.Prefix {
+		return fmt.Errorf("key %q not found in snapshot at revision %d", g.Key, revision)
+	}
+	log.Debugf(PKG_CMD, "Found %d keys at revision %d", len(kvs), revision)
+
+	records := make([]etcd.KeyRecord, 0, len(kvs))
+	for _, kv := range kvs {
+		records = append(records, etcd.NewKeyRecord(kv))
+	}
+
+	switch g.Format {
+	case "json":
+		out, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal keys to JSON: %w", err)
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			if err := encoder.Encode(record); err != nil {
+				return fmt.Errorf("failed to write key %q: %w", record.KeyBytes(), err)
+			}
+		}
+		return nil
+	default:
+		// Same layout as etcdctl: a single key prints its value, a prefix prints key and value lines
+		for _, kv := range kvs {
+			if g.Prefix {
+				if _, err := fmt.Fprintf(w, "%s\n", kv.Key); err != nil {
+					return err
+				}
+			}
+			if _, err := fmt.Fprintf(w, "%s\n", kv.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+)
+
+func TestGet(tMain *testing.T) {
+	srv := etcdtest.Start(tMain, etcdtest.Config{})
+	srv.PutKeys(tMain, map[string]string{
+		"/registry/configmaps/default/app": "old",
+		"/registry/configmaps/kube/dns":    "dns",
+		"/registry/pods/default/web":       "web",
+	})
+	srv.PutKeys(tMain, map[string]string{"/registry/configmaps/default/app": "new"})
+
+	ctx := newTestCLIContext(tMain, srv)
+	require.NoError(tMain, (&SnapshotCmd{Name: "get", Compression: "none"}).Run(ctx))
+	snapshotPath := filepath.Join(ctx.Config.Etcd.SnapshotDir, "get.db")
+
+	tests := []struct {
+		name     string
+		cmd      GetCmd
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "single key raw",
+			cmd:      GetCmd{Key: "/registry/configmaps/default/app", Format: "raw"},
+			expected: "new\n",
+		},
+		{
+			name:     "prefix raw",
+			cmd:      GetCmd{Key: "/registry/configmaps/", Prefix: true, Format: "raw"},
+			expected: "/registry/configmaps/default/app\nnew\n/registry/configmaps/kube/dns\ndns\n",
+		},
+		{
+			name:    "missing key",
+			cmd:     GetCmd{Key: "/registry/configmaps/default/missing", Format: "raw"},
+			wantErr: true,
+		},
+		{
+			name: "empty prefix",
+			cmd:  GetCmd{Key: "/missing/", Prefix: true, Format: "raw"},
+		},
+	}
+
+	for _, tt := range tests {
+		tMain.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := tt.cmd.get(snapshotPath, &out)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out.String())
+		})
+	}
+
+	tMain.Run("json", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, (&GetCmd{Key: "/registry/", Prefix: true, Format: "json"}).get(snapshotPath, &out))
+		var records []etcd.KeyRecord
+		require.NoError(t, json.Unmarshal(out.Bytes(), &records))
+		require.Len(t, records, 3)
+		assert.Equal(t, "/registry/configmaps/default/app", records[0].Key)
+		assert.Equal(t, []byte("new"), records[0].Value)
+		assert.Equal(t, int64(2), records[0].Version)
+	})
+
+	tMain.Run("ndjson", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, (&GetCmd{Key: "/registry/pods/", Prefix: true, Format: "ndjson"}).get(snapshotPath, &out))
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		require.Len(t, lines, 1)
+		var record etcd.KeyRecord
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+		assert.Equal(t, "/registry/pods/default/web", record.Key)
+		assert.Equal(t, []byte("web"), record.Value)
+	})
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thedataflows/etcd2s3/pkg/snapshotdb"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// InspectCmd reports what a snapshot contains without restoring it
+type InspectCmd struct {
+	Source string `kong:"arg,required,help='Snapshot source (local path, s3:// URL or S3 key)'"`
+	Depth  int    `kong:"help='Number of key path segments that make up a prefix',default='2'"`
+	Top    int    `kong:"help='Number of largest prefixes to show, 0 shows all',default='20'"`
+	Format string `kong:"help='Output format (table,json)',default='table',enum='table,json'"`
+}
+
+// InspectReport describes the contents of a snapshot
+type InspectReport struct {
+	Snapshot        string              `json:"snapshot"`
+	Revision        int64               `json:"revision"`
+	CompactRevision int64               `json:"compact_revision"`
+	ConsistentIndex uint64              `json:"consistent_index"`
+	Term            uint64              `json:"term"`
+	TotalKeys       int                 `json:"total_keys"`
+	TotalSize       int64               `json:"total_size"`
+	DataSize        int64               `json:"data_size"`
+	ClusterID       uint64              `json:"cluster_id,omitempty"`
+	ClusterVersion  string              `json:"cluster_version,omitempty"`
+	StorageVersion  string              `json:"storage_version,omitempty"`
+	Members         []snapshotdb.Member `json:"members"`
+	Prefixes        []PrefixStats       `json:"prefixes"`
+}
+
+// PrefixStats holds the number of keys and bytes (keys and values) under a prefix
+type PrefixStats struct {
+	Prefix string `json:"prefix"`
+	Keys   int    `json:"keys"`
+	Bytes  int64  `json:"bytes"`
+}
+
+func (i *InspectCmd) Run(ctx *CLIContext) error {
+	ctx, err := ctx.SingleCluster()
+	if err != nil {
+		return err
+	}
+
+	workDir, err := os.MkdirTemp("", "etcd2s3-inspect-")
+	if err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	storedPath, key, err := fetchStoredArtifact(ctx, i.Source, workDir)
+	if err != nil {
+		return err
+	}
+	snapshotPath, err := decompressArtifact(storedPath, workDir)
+	if err != nil {
+		return err
+	}
+
+	report, err := i.inspect(snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	// The cluster ID is not stored in the snapshot itself, only in its manifest
+	if m, err := loadArtifactManifest(ctx, storedPath, key); err == nil {
+		report.ClusterID = m.ClusterID
+	} else {
+		log.Debugf(PKG_CMD, "No manifest for %s: %v", i.Source, err)
+	}
+
+	switch i.Format {
+	case "json":
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal report to JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	default:
+		return i.outputTable(report)
+	}
+}
+
+// inspect reads the metadata and key statistics of an uncompressed snapshot
+func (i *InspectCmd) inspect(snapshotPath string) (*InspectReport, error) {
+	db, err := snapshotdb.Open(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	meta, err := db.Meta()
+	if err != nil {
+		return nil, err
+	}
+	members, err := db.Members()
+	if err != nil {
+		return nil, err
+	}
+	keys, revision, err := db.LatestKeyStats(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &InspectReport{
+		Snapshot:        i.Source,
+		Revision:        revision,
+		CompactRevision: meta.CompactRevision,
+		ConsistentIndex: meta.ConsistentIndex,
+		Term:            meta.Term,
+		TotalKeys:       len(keys),
+		TotalSize:       db.Size(),
+		ClusterVersion:  meta.ClusterVersion,
+		StorageVersion:  meta.StorageVersion,
+		Members:         members,
+		Prefixes:        prefixStats(keys, i.Depth),
+	}
+	for _, prefix := range report.Prefixes {
+		report.DataSize += prefix.Bytes
+	}
+	if i.Top > 0 && len(report.Prefixes) > i.Top {
+		report.Prefixes = report.Prefixes[:i.Top]
+	}
+
+	return report, nil
+}
+
+// prefixStats aggregates keys by prefix, largest first
+func prefixStats(keys []snapshotdb.KeyStat, depth int) []PrefixStats {
+	byPrefix := make(map[string]*PrefixStats)
+	for _, key := range keys {
+		prefix := snapshotdb.Prefix(key.Key, depth)
+		stats, ok := byPrefix[prefix]
+		if !ok {
+			stats = &PrefixStats{Prefix: prefix}
+			byPrefix[prefix] = stats
+		}
+		stats.Keys++
+		stats.Bytes += key.Size
+	}
+
+	result := make([]PrefixStats, 0, len(byPrefix))
+	for _, stats := range byPrefix {
+		result = append(result, *stats)
+	}
+	slices.SortFunc(result, func(a, b PrefixStats) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(a.Prefix, b.Prefix))
+	})
+	return result
+}
+
+func (i *InspectCmd) outputTable(report *InspectReport) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintf(w, "Snapshot:\t%s\n", report.Snapshot)
+	_, _ = fmt.Fprintf(w, "Revision:\t%d\n", report.Revision)
+	_, _ = fmt.Fprintf(w, "Compacted revision:\t%d\n", report.CompactRevision)
+	_, _ = fmt.Fprintf(w, "Raft index / term:\t%d / %d\n", report.ConsistentIndex, report.Term)
+	_, _ = fmt.Fprintf(w, "Keys:\t%d\n", report.TotalKeys)
+	_, _ = fmt.Fprintf(w, "Size:\t%s (%s keys and values)\n", formatSize(report.TotalSize), formatSize(report.DataSize))
+	if report.ClusterID != 0 {
+		_, _ = fmt.Fprintf(w, "Cluster ID:\t%x\n", report.ClusterID)
+	}
+	if report.ClusterVersion != "" {
+		_, _ = fmt.Fprintf(w, "Cluster version:\t%s\n", report.ClusterVersion)
+	}
+	_, _ = fmt.Fprintln(w)
+
+	_, _ = fmt.Fprintln(w, "MEMBER ID\tNAME\tPEER URLS\tCLIENT URLS")
+	for _, member := range report.Members {
+		_, _ = fmt.Fprintf(w, "%x\t%s\t%s\t%s\n", member.ID, member.Name, strings.Join(member.PeerURLs, ","), strings.Join(member.ClientURLs, ","))
+	}
+	_, _ = fmt.Fprintln(w)
+
+	_, _ = fmt.Fprintln(w, "PREFIX\tKEYS\tSIZE")
+	for _, prefix := range report.Prefixes {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\n", prefix.Prefix, prefix.Keys, formatSize(prefix.Bytes))
+	}
+
+	return w.Flush()
+}
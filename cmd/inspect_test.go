@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+)
+
+func TestInspect(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.Config{})
+	srv.PutKeys(t, map[string]string{
+		"/registry/pods/default/a":    "aaaa",
+		"/registry/pods/default/b":    "bbbb",
+		"/registry/configmaps/kube/c": "c",
+	})
+
+	ctx := newTestCLIContext(t, srv)
+	require.NoError(t, (&SnapshotCmd{Name: "inspect", Compression: "gzip"}).Run(ctx))
+
+	inspectCmd := &InspectCmd{Source: filepath.Join(ctx.Config.Etcd.SnapshotDir, "inspect.db"), Depth: 2, Top: 1}
+	workDir := t.TempDir()
+	snapshotPath, err := fetchArtifact(ctx, inspectCmd.Source, workDir)
+	require.NoError(t, err)
+
+	report, err := inspectCmd.inspect(snapshotPath)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.TotalKeys)
+	assert.Positive(t, report.Revision)
+	assert.Len(t, report.Members, 1)
+	require.Len(t, report.Prefixes, 1)
+	assert.Equal(t, PrefixStats{Prefix: "/registry/pods/", Keys: 2, Bytes: 56}, report.Prefixes[0])
+
+	// The cluster ID comes from the manifest next to the stored snapshot
+	storedPath, key, err := fetchStoredArtifact(ctx, inspectCmd.Source, workDir)
+	require.NoError(t, err)
+	m, err := loadArtifactManifest(ctx, storedPath, key)
+	require.NoError(t, err)
+	assert.NotZero(t, m.ClusterID)
+}
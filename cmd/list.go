@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"path/filepath"
+	"slices"
 	"sort"
 	"text/tabwriter"
 	"time"
@@ -24,18 +24,93 @@ type ListCmd struct {
 }
 
 type SnapshotInfo struct {
+	Cluster   string    `json:"cluster,omitempty"`
 	Name      string    `json:"name"`
 	Location  string    `json:"location"`
 	Size      int64     `json:"size"`
+	Created   time.Time `json:"created"`
 	Modified  time.Time `json:"modified"`
 	Retention string    `json:"retention"` // "keep" or "delete"
 }
 
+// TierUsage is the space used by the snapshots of one storage tier, now and once
+// retention has run, with the caps of the tier (0 is unlimited)
+type TierUsage struct {
+	Cluster       string          `json:"cluster,omitempty"`
+	Location      string          `json:"location"`
+	Current       retention.Usage `json:"current"`
+	Projected     retention.Usage `json:"projected"`
+	MaxCount      int             `json:"max_count"`
+	MaxTotalBytes int64           `json:"max_total_bytes"`
+}
+
+// listDocument is the JSON and YAML output of list
+type listDocument struct {
+	Snapshots []SnapshotInfo `json:"snapshots"`
+	Usage     []TierUsage    `json:"usage"`
+}
+
 func (l *ListCmd) Run(ctx *CLIContext) error {
 	log.Info(PKG_CMD, "Listing snapshots")
 
+	var snapshots []SnapshotInfo
+	var usage []TierUsage
+	err := ctx.ForEachCluster(func(ctx *CLIContext) error {
+		clusterSnapshots, err := l.list(ctx)
+		if err != nil {
+			return err
+		}
+		for i := range clusterSnapshots {
+			clusterSnapshots[i].Cluster = ctx.Cluster
+		}
+		snapshots = append(snapshots, clusterSnapshots...)
+		usage = append(usage, l.usage(ctx, clusterSnapshots)...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Sort by creation time (newest first)
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.After(snapshots[j].Created)
+	})
+
+	return l.outputSnapshots(snapshots, usage)
+}
+
+// usage sums the snapshots of a single cluster per listed storage tier
+func (l *ListCmd) usage(ctx *CLIContext, snapshots []SnapshotInfo) []TierUsage {
+	var tiers []TierUsage
+	if !l.Remote {
+		policy := ctx.Config.LocalRetention()
+		tiers = append(tiers, TierUsage{Cluster: ctx.Cluster, Location: "local", MaxCount: policy.MaxCount, MaxTotalBytes: policy.MaxTotalBytes})
+	}
+	if !l.Local && ctx.GetS3ClientOrNil() != nil {
+		policy := ctx.Config.RemoteRetention()
+		tiers = append(tiers, TierUsage{Cluster: ctx.Cluster, Location: "s3", MaxCount: policy.MaxCount, MaxTotalBytes: policy.MaxTotalBytes})
+	}
+
+	for i := range tiers {
+		for _, snapshot := range snapshots {
+			if snapshot.Location != tiers[i].Location {
+				continue
+			}
+			tiers[i].Current.Count++
+			tiers[i].Current.Bytes += snapshot.Size
+			if snapshot.Retention == "keep" {
+				tiers[i].Projected.Count++
+				tiers[i].Projected.Bytes += snapshot.Size
+			}
+		}
+	}
+	return tiers
+}
+
+// list lists the snapshots of a single cluster
+func (l *ListCmd) list(ctx *CLIContext) ([]SnapshotInfo, error) {
 	// Create retention manager
-	retentionMgr := retention.NewManager(ctx.Config.Policy)
+	retentionMgr := ctx.GetRetentionManager()
 
 	// Use unified approach if both local and remote snapshots are being listed
 	if l.Unified && !l.Local && !l.Remote {
@@ -46,29 +121,29 @@ func (l *ListCmd) Run(ctx *CLIContext) error {
 	return l.runSeparateList(ctx, retentionMgr)
 }
 
-func (l *ListCmd) runUnifiedList(ctx *CLIContext, retentionMgr *retention.Manager) error {
+func (l *ListCmd) runUnifiedList(ctx *CLIContext, retentionMgr *retention.Manager) ([]SnapshotInfo, error) {
 	// Get snapshots from both locations
-	localRetentionSnapshots, err := l.getLocalRetentionSnapshots(ctx.Config.Etcd.SnapshotDir)
+	localRetentionSnapshots, err := retentionMgr.GetLocalSnapshots(ctx.Config.Etcd.SnapshotDir)
 	if err != nil {
 		log.Logger.Error().Err(err).Str(log.KEY_PKG, PKG_CMD).Msg("Failed to get local snapshots")
 		localRetentionSnapshots = nil
 	}
 
-	s3RetentionSnapshots, err := l.getS3RetentionSnapshots(ctx)
+	s3RetentionSnapshots, err := l.getS3RetentionSnapshots(ctx, retentionMgr)
 	if err != nil {
 		log.Logger.Error().Err(err).Str(log.KEY_PKG, PKG_CMD).Str("url", ctx.Config.S3.EndpointURL).Str("bucket", ctx.Config.S3.Bucket).Msg("Failed to get S3 snapshots")
 		s3RetentionSnapshots = nil
 	}
 
 	// Get unified retention decisions
-	retentionDecisions := retentionMgr.GetUnifiedRetentionStatus(localRetentionSnapshots, s3RetentionSnapshots)
+	retentionDecisions := retentionMgr.GetUnifiedRetentionStatus(localRetentionSnapshots, s3RetentionSnapshots, ctx.GetS3ClientOrNil() != nil)
 
 	var snapshots []SnapshotInfo
 
 	// Build final snapshot list with unified retention status
 	for _, retSnap := range localRetentionSnapshots {
 		retentionStatus := "delete"
-		if retentionDecisions[retSnap.Name] {
+		if retentionDecisions.Local[retSnap.Name] {
 			retentionStatus = "keep"
 		}
 
@@ -76,6 +151,7 @@ func (l *ListCmd) runUnifiedList(ctx *CLIContext, retentionMgr *retention.Manage
 			Name:      retSnap.Name,
 			Location:  "local",
 			Size:      retSnap.Size,
+			Created:   retSnap.Created(),
 			Modified:  retSnap.ModTime,
 			Retention: retentionStatus,
 		})
@@ -83,7 +159,7 @@ func (l *ListCmd) runUnifiedList(ctx *CLIContext, retentionMgr *retention.Manage
 
 	for _, retSnap := range s3RetentionSnapshots {
 		retentionStatus := "delete"
-		if retentionDecisions[retSnap.Name] {
+		if retentionDecisions.Remote[retSnap.Name] {
 			retentionStatus = "keep"
 		}
 
@@ -91,20 +167,16 @@ func (l *ListCmd) runUnifiedList(ctx *CLIContext, retentionMgr *retention.Manage
 			Name:      retSnap.Name,
 			Location:  "s3",
 			Size:      retSnap.Size,
+			Created:   retSnap.Created(),
 			Modified:  retSnap.ModTime,
 			Retention: retentionStatus,
 		})
 	}
 
-	// Sort by modified time (newest first)
-	sort.Slice(snapshots, func(i, j int) bool {
-		return snapshots[i].Modified.After(snapshots[j].Modified)
-	})
-
-	return l.outputSnapshots(snapshots)
+	return snapshots, nil
 }
 
-func (l *ListCmd) runSeparateList(ctx *CLIContext, retentionMgr *retention.Manager) error {
+func (l *ListCmd) runSeparateList(ctx *CLIContext, retentionMgr *retention.Manager) ([]SnapshotInfo, error) {
 	var snapshots []SnapshotInfo
 
 	// List local snapshots
@@ -127,64 +199,34 @@ func (l *ListCmd) runSeparateList(ctx *CLIContext, retentionMgr *retention.Manag
 		}
 	}
 
-	// Sort by modified time (newest first)
-	sort.Slice(snapshots, func(i, j int) bool {
-		return snapshots[i].Modified.After(snapshots[j].Modified)
-	})
-
-	return l.outputSnapshots(snapshots)
+	return snapshots, nil
 }
 
-func (l *ListCmd) outputSnapshots(snapshots []SnapshotInfo) error {
+func (l *ListCmd) outputSnapshots(snapshots []SnapshotInfo, usage []TierUsage) error {
 	switch l.Format {
 	case "json":
-		return l.outputJSON(snapshots)
+		return l.outputJSON(listDocument{Snapshots: snapshots, Usage: usage})
 	case "yaml":
-		return l.outputYAML(snapshots)
+		return l.outputYAML(listDocument{Snapshots: snapshots, Usage: usage})
 	default:
-		return l.outputTable(snapshots)
+		if err := l.outputTable(snapshots); err != nil {
+			return err
+		}
+		return l.outputUsage(usage)
 	}
 }
 
 func (l *ListCmd) listLocal(snapshotDir string, retentionMgr *retention.Manager) ([]SnapshotInfo, error) {
 	var snapshots []SnapshotInfo
 
-	if _, err := os.Stat(snapshotDir); os.IsNotExist(err) {
-		return snapshots, nil
-	}
-
-	entries, err := os.ReadDir(snapshotDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read snapshot directory: %w", err)
-	}
-
 	// Build retention snapshots for analysis
-	var retentionSnapshots []retention.SnapshotFile
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		if !retention.IsSnapshotFile(entry.Name()) {
-			continue
-		}
-
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		retentionSnapshots = append(retentionSnapshots, retention.SnapshotFile{
-			Name:     entry.Name(),
-			Path:     filepath.Join(snapshotDir, entry.Name()),
-			Size:     info.Size(),
-			ModTime:  info.ModTime(),
-			IsRemote: false,
-		})
+	retentionSnapshots, err := retentionMgr.GetLocalSnapshots(snapshotDir)
+	if err != nil {
+		return nil, err
 	}
 
 	// Determine which snapshots to keep according to retention policy
-	toKeep := retentionMgr.GetRetentionStatus(retentionSnapshots)
+	toKeep := retentionMgr.GetLocalRetentionStatus(retentionSnapshots)
 
 	// Build final snapshot list with retention status
 	for _, retSnap := range retentionSnapshots {
@@ -197,6 +239,7 @@ func (l *ListCmd) listLocal(snapshotDir string, retentionMgr *retention.Manager)
 			Name:      retSnap.Name,
 			Location:  "local",
 			Size:      retSnap.Size,
+			Created:   retSnap.Created(),
 			Modified:  retSnap.ModTime,
 			Retention: retentionStatus,
 		})
@@ -206,30 +249,14 @@ func (l *ListCmd) listLocal(snapshotDir string, retentionMgr *retention.Manager)
 }
 
 func (l *ListCmd) listS3(ctx *CLIContext, retentionMgr *retention.Manager) ([]SnapshotInfo, error) {
-	s3Client, err := ctx.GetS3Client()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create S3 client: %w", err)
-	}
-
-	objects, err := s3Client.List(context.Background(), "")
-	if err != nil {
-		return nil, fmt.Errorf("failed to list S3 objects: %w", err)
-	}
-
 	// Build retention snapshots for analysis
-	var retentionSnapshots []retention.SnapshotFile
-	for _, obj := range objects {
-		retentionSnapshots = append(retentionSnapshots, retention.SnapshotFile{
-			Name:     filepath.Base(obj.Key),
-			Path:     obj.Key,
-			Size:     obj.Size,
-			ModTime:  obj.LastModified,
-			IsRemote: true,
-		})
+	retentionSnapshots, err := l.getS3RetentionSnapshots(ctx, retentionMgr)
+	if err != nil {
+		return nil, err
 	}
 
 	// Determine which snapshots to keep according to retention policy
-	toKeep := retentionMgr.GetRetentionStatus(retentionSnapshots)
+	toKeep := retentionMgr.GetRemoteRetentionStatus(retentionSnapshots)
 
 	// Build final snapshot list with retention status
 	var snapshots []SnapshotInfo
@@ -243,6 +270,7 @@ func (l *ListCmd) listS3(ctx *CLIContext, retentionMgr *retention.Manager) ([]Sn
 			Name:      retSnap.Name,
 			Location:  "s3",
 			Size:      retSnap.Size,
+			Created:   retSnap.Created(),
 			Modified:  retSnap.ModTime,
 			Retention: retentionStatus,
 		})
@@ -253,14 +281,23 @@ func (l *ListCmd) listS3(ctx *CLIContext, retentionMgr *retention.Manager) ([]Sn
 
 func (l *ListCmd) outputTable(snapshots []SnapshotInfo) error {
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	_, _ = fmt.Fprintln(w, "NAME\tLOCATION\tSIZE\tMODIFIED\tRETENTION")
+
+	// Show the cluster column only when listing named clusters
+	withCluster := slices.ContainsFunc(snapshots, func(s SnapshotInfo) bool { return s.Cluster != "" })
+	if withCluster {
+		_, _ = fmt.Fprint(w, "CLUSTER\t")
+	}
+	_, _ = fmt.Fprintln(w, "NAME\tLOCATION\tSIZE\tCREATED\tRETENTION")
 
 	for _, snapshot := range snapshots {
+		if withCluster {
+			_, _ = fmt.Fprintf(w, "%s\t", snapshot.Cluster)
+		}
 		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
 			snapshot.Name,
 			snapshot.Location,
 			formatSize(snapshot.Size),
-			snapshot.Modified.Format("2006-01-02 15:04:05"),
+			snapshot.Created.Format("2006-01-02 15:04:05"),
 			snapshot.Retention,
 		)
 	}
@@ -268,8 +305,48 @@ func (l *ListCmd) outputTable(snapshots []SnapshotInfo) error {
 	return w.Flush()
 }
 
-func (l *ListCmd) outputJSON(snapshots []SnapshotInfo) error {
-	out, err := json.MarshalIndent(snapshots, "", "  ")
+// outputUsage prints the usage of every storage tier after the snapshot table
+func (l *ListCmd) outputUsage(usage []TierUsage) error {
+	if len(usage) == 0 {
+		return nil
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	withCluster := slices.ContainsFunc(usage, func(u TierUsage) bool { return u.Cluster != "" })
+	if withCluster {
+		_, _ = fmt.Fprint(w, "CLUSTER\t")
+	}
+	_, _ = fmt.Fprintln(w, "LOCATION\tSNAPSHOTS\tSIZE\tAFTER RETENTION\tSIZE AFTER RETENTION\tMAX COUNT\tMAX SIZE")
+
+	for _, u := range usage {
+		if withCluster {
+			_, _ = fmt.Fprintf(w, "%s\t", u.Cluster)
+		}
+		maxCount, maxSize := "-", "-"
+		if u.MaxCount > 0 {
+			maxCount = fmt.Sprint(u.MaxCount)
+		}
+		if u.MaxTotalBytes > 0 {
+			maxSize = formatSize(u.MaxTotalBytes)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%s\t%s\t%s\n",
+			u.Location,
+			u.Current.Count,
+			formatSize(u.Current.Bytes),
+			u.Projected.Count,
+			formatSize(u.Projected.Bytes),
+			maxCount,
+			maxSize,
+		)
+	}
+
+	return w.Flush()
+}
+
+func (l *ListCmd) outputJSON(document listDocument) error {
+	out, err := json.MarshalIndent(document, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal snapshots to JSON: %w", err)
 	}
@@ -277,8 +354,8 @@ func (l *ListCmd) outputJSON(snapshots []SnapshotInfo) error {
 	return nil
 }
 
-func (l *ListCmd) outputYAML(snapshots []SnapshotInfo) error {
-	out, err := yaml.MarshalWithOptions(snapshots, yaml.Indent(4))
+func (l *ListCmd) outputYAML(document listDocument) error {
+	out, err := yaml.MarshalWithOptions(document, yaml.Indent(4))
 	if err != nil {
 		return fmt.Errorf("failed to marshal snapshots to YAML: %w", err)
 	}
@@ -299,67 +376,11 @@ func formatSize(size int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
 }
 
-// getLocalRetentionSnapshots returns snapshots from local directory for unified retention evaluation
-func (l *ListCmd) getLocalRetentionSnapshots(snapshotDir string) ([]retention.SnapshotFile, error) {
-	var snapshots []retention.SnapshotFile
-
-	if _, err := os.Stat(snapshotDir); os.IsNotExist(err) {
-		return snapshots, nil
-	}
-
-	entries, err := os.ReadDir(snapshotDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read snapshot directory: %w", err)
-	}
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		if !retention.IsSnapshotFile(entry.Name()) {
-			continue
-		}
-
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		snapshots = append(snapshots, retention.SnapshotFile{
-			Name:     entry.Name(),
-			Path:     filepath.Join(snapshotDir, entry.Name()),
-			Size:     info.Size(),
-			ModTime:  info.ModTime(),
-			IsRemote: false,
-		})
-	}
-
-	return snapshots, nil
-}
-
 // getS3RetentionSnapshots returns snapshots from S3 for unified retention evaluation
-func (l *ListCmd) getS3RetentionSnapshots(ctx *CLIContext) ([]retention.SnapshotFile, error) {
+func (l *ListCmd) getS3RetentionSnapshots(ctx *CLIContext, retentionMgr *retention.Manager) ([]retention.SnapshotFile, error) {
 	s3Client, err := ctx.GetS3Client()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create S3 client: %w", err)
 	}
-
-	objects, err := s3Client.List(context.Background(), "")
-	if err != nil {
-		return nil, fmt.Errorf("failed to list S3 objects: %w", err)
-	}
-
-	var snapshots []retention.SnapshotFile
-	for _, obj := range objects {
-		snapshots = append(snapshots, retention.SnapshotFile{
-			Name:     filepath.Base(obj.Key),
-			Path:     obj.Key,
-			Size:     obj.Size,
-			ModTime:  obj.LastModified,
-			IsRemote: true,
-		})
-	}
-
-	return snapshots, nil
+	return retentionMgr.GetS3Snapshots(context.Background(), s3Client)
 }
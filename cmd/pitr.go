@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/embedded"
+	"github.com/thedataflows/etcd2s3/pkg/segment"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// replayBatchSize is the number of events applied at once during point-in-time recovery
+const replayBatchSize = 1000
+
+// errReplayDone stops reading segments once the recovery target is reached
+var errReplayDone = errors.New("recovery target reached")
+
+// pointInTimeRequested reports whether the restore should replay segments
+func (r *RestoreCmd) pointInTimeRequested() bool {
+	return r.ToRevision > 0 || !r.ToTime.IsZero()
+}
+
+// pointInTime rebuilds the keyspace at the requested revision or time: the snapshot is
+// restored into a scratch member, the recorded segments are replayed on top of it and a
+// new snapshot is taken from it. Returns the path of that snapshot, inside workDir.
+func (r *RestoreCmd) pointInTime(ctx *CLIContext, snapshotPath, workDir string) (string, error) {
+	status, err := etcd.ReadSnapshotStatus(snapshotPath)
+	if err != nil {
+		return "", err
+	}
+	base := status.Revision
+	if r.ToRevision > 0 && r.ToRevision < base {
+		return "", fmt.Errorf("requested revision %d is older than the snapshot revision %d", r.ToRevision, base)
+	}
+
+	chain, err := segment.Chain(r.findSegments(ctx), base, r.ToRevision)
+	if err != nil {
+		return "", fmt.Errorf("cannot replay changes after snapshot revision %d: %w", base, err)
+	}
+	if len(chain) == 0 {
+		log.Infof(PKG_CMD, "No recorded changes after snapshot revision %d, restoring the snapshot as is", base)
+		return snapshotPath, nil
+	}
+
+	log.Infof(PKG_CMD, "Replaying %d segments on top of snapshot revision %d", len(chain), base)
+
+	// Restore the snapshot into a scratch single member cluster
+	peerURL, err := embedded.FreeURL()
+	if err != nil {
+		return "", err
+	}
+	dataDir := filepath.Join(workDir, "pitr")
+	err = etcd.RestoreSnapshot(context.Background(), etcd.RestoreOptions{
+		SnapshotPath:             snapshotPath,
+		DataDir:                  dataDir,
+		Name:                     "pitr",
+		InitialCluster:           "pitr=" + peerURL,
+		InitialAdvertisePeerURLs: []string{peerURL},
+		SkipHashCheck:            r.SkipHashCheck,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to restore snapshot for replay: %w", err)
+	}
+
+	srv, err := embedded.Start(embedded.Config{Name: "pitr", DataDir: dataDir, PeerURL: peerURL, UnsafeNoFsync: true})
+	if err != nil {
+		return "", err
+	}
+	defer srv.Stop()
+
+	client, err := etcd.NewClient(appconfig.EtcdConfig{Endpoints: []string{srv.Endpoint}, SnapshotSource: etcd.StrategyFirst})
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to replay member: %w", err)
+	}
+	defer client.Close()
+
+	revision, err := r.replaySegments(ctx, client, chain, base, workDir)
+	if err != nil {
+		return "", err
+	}
+
+	if current, err := client.Revision(context.Background()); err == nil && current != revision {
+		log.Warnf(PKG_CMD, "Replayed up to source revision %d but the restored revision is %d", revision, current)
+	}
+
+	pitrPath := filepath.Join(workDir, "pitr.db")
+	if _, err := client.Snapshot(context.Background(), pitrPath); err != nil {
+		return "", fmt.Errorf("failed to snapshot replayed state: %w", err)
+	}
+
+	log.Infof(PKG_CMD, "Recovered state at revision %d", revision)
+	return pitrPath, nil
+}
+
+// replaySegments applies the events of the chain after revision base, up to the requested
+// revision or time, and returns the last revision applied.
+// Events are applied in whole revisions so the revisions match the source cluster.
+func (r *RestoreCmd) replaySegments(ctx *CLIContext, client *etcd.Client, chain []segment.Ref, base int64, workDir string) (int64, error) {
+	applied := base
+	var batch []etcd.WatchEvent
+
+	apply := func() error {
+		if err := client.ApplyEvents(context.Background(), batch); err != nil {
+			return err
+		}
+		batch = nil
+		return nil
+	}
+
+	for _, ref := range chain {
+		segmentDir, err := os.MkdirTemp(workDir, "segment-")
+		if err != nil {
+			return 0, fmt.Errorf("failed to create segment directory: %w", err)
+		}
+
+		segmentPath, err := fetchArtifact(ctx, ref.Path, segmentDir)
+		if err != nil {
+			return 0, err
+		}
+
+		covered := applied
+		err = segment.Read(segmentPath, func(event etcd.WatchEvent) error {
+			switch {
+			case event.ModRevision <= covered:
+				// Already in the snapshot or a previous segment
+				return nil
+			case r.ToRevision > 0 && event.ModRevision > r.ToRevision:
+				return errReplayDone
+			case !r.ToTime.IsZero() && event.ObservedAt.After(r.ToTime):
+				return errReplayDone
+			}
+
+			// Only cut batches between revisions
+			if len(batch) >= replayBatchSize && event.ModRevision != batch[len(batch)-1].ModRevision {
+				if err := apply(); err != nil {
+					return err
+				}
+			}
+			batch = append(batch, event)
+			applied = event.ModRevision
+			return nil
+		})
+		_ = os.RemoveAll(segmentDir)
+
+		if errors.Is(err, errReplayDone) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		log.Debugf(PKG_CMD, "Replayed segment %s", ref.Name)
+	}
+
+	if len(batch) > 0 {
+		if err := apply(); err != nil {
+			return 0, err
+		}
+	}
+
+	return applied, nil
+}
+
+// findSegments lists the segments stored locally and in S3, local copies first
+func (r *RestoreCmd) findSegments(ctx *CLIContext) []segment.Ref {
+	var refs []segment.Ref
+
+	entries, err := os.ReadDir(ctx.Config.Etcd.SnapshotDir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf(PKG_CMD, "Failed to read snapshot directory: %v", err)
+	}
+	for _, entry := range entries {
+		if ref, ok := segment.NewRef(filepath.Join(ctx.Config.Etcd.SnapshotDir, entry.Name())); ok {
+			refs = append(refs, ref)
+		}
+	}
+
+	if ctx.Config.S3.Bucket == "" {
+		return refs
+	}
+	s3Client, err := ctx.GetS3Client()
+	if err != nil {
+		log.Warnf(PKG_CMD, "S3 client unavailable, only local segments are used: %v", err)
+		return refs
+	}
+	objects, err := s3Client.List(context.Background(), segment.Prefix)
+	if err != nil {
+		log.Warnf(PKG_CMD, "Failed to list S3 segments, only local segments are used: %v", err)
+		return refs
+	}
+	for _, object := range objects {
+		if ref, ok := segment.NewRef(object.Key); ok {
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs
+}
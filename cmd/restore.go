@@ -10,28 +10,92 @@ import (
 
 	"github.com/thedataflows/etcd2s3/pkg/compression"
 	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	"github.com/thedataflows/etcd2s3/pkg/manifest"
 	log "github.com/thedataflows/go-lib-log"
 )
 
 // RestoreCmd restores etcd from a snapshot
 type RestoreCmd struct {
-	Source                   string `kong:"arg,required,help='Snapshot source (local path or S3 key)'"`
-	DataDir                  string `kong:"help='etcd data directory for restore',default='/var/lib/etcd'"`
-	Name                     string `kong:"help='etcd member name',default='default'"`
-	InitialCluster           string `kong:"help='Initial cluster configuration',default='default=http://localhost:2380'"`
-	InitialAdvertisePeerURLs string `kong:"help='Initial advertise peer URLs',default='http://localhost:2380'"`
-	SkipHashCheck            bool   `kong:"help='Skip hash check during restore'"`
+	Source                   string    `kong:"arg,optional,help='Snapshot source (local path, s3:// URL, S3 key or latest)'"`
+	At                       time.Time `kong:"help='Restore the newest snapshot taken at or before this time, RFC 3339',xor='select'"`
+	Revision                 int64     `kong:"help='Restore the newest snapshot at or before this revision, from snapshot manifests',xor='select'"`
+	DataDir                  string    `kong:"help='etcd data directory for restore',default='/var/lib/etcd'"`
+	WALDir                   string    `kong:"name='wal-dir',help='etcd WAL directory (etcd --wal-dir), default is inside the data directory'"`
+	SnapshotCount            uint64    `kong:"help='etcd --snapshot-count the member is started with, added to the printed etcd flags'"`
+	UID                      string    `kong:"name='uid',help='User ID owning the restored directories and files, default is the current user'"`
+	GID                      string    `kong:"name='gid',help='Group ID owning the restored directories and files, default is the current group'"`
+	DirMode                  string    `kong:"help='Octal mode of the restored directories, e.g. 0700'"`
+	Name                     string    `kong:"help='etcd member name',default='default'"`
+	InitialCluster           string    `kong:"help='Initial cluster configuration',default='default=http://localhost:2380'"`
+	InitialAdvertisePeerURLs []string  `kong:"help='Initial advertise peer URLs',default='http://localhost:2380'"`
+	InitialClusterToken      string    `kong:"help='Initial cluster token of the restored cluster',default='etcd-cluster'"`
+	Member                   []string  `kong:"help='Restore a cluster member, name=peerURL[,peerURL...], repeat for every member',sep='none',xor='members'"`
+	MembersFromSnapshot      bool      `kong:"help='Restore every member recorded in the snapshot',xor='members'"`
+	Plan                     bool      `kong:"help='Only print the etcd flags of every member, do not write data directories'"`
+	Force                    bool      `kong:"help='Move existing non-empty data directories to a timestamped backup before restoring'"`
+	DryRun                   bool      `kong:"help='Check the data directories and print the restore plan without restoring'"`
+	ScratchDir               string    `kong:"help='Directory for downloaded and decompressed snapshots, default is the system temp directory'"`
+	KeepArtifacts            bool      `kong:"help='Keep downloaded and decompressed snapshots in the scratch directory after the restore'"`
+	SkipHashCheck            bool      `kong:"help='Skip hash check during restore'"`
+	BumpRevision             string    `kong:"help='Increase the revision after restore by this amount, or auto to derive it from the snapshot age and write rate (requires --mark-compacted)'"`
+	MarkCompacted            bool      `kong:"help='Mark the bumped revision as compacted (requires --bump-revision)'"`
+	ToRevision               int64     `kong:"help='Replay recorded changes up to this revision (point-in-time recovery)',xor='pitr'"`
+	ToTime                   time.Time `kong:"help='Replay recorded changes observed by watch up to this time, RFC 3339 (point-in-time recovery)',xor='pitr'"`
 }
 
 func (r *RestoreCmd) Run(ctx *CLIContext) error {
+	ctx, err := ctx.SingleCluster()
+	if err != nil {
+		return err
+	}
+
+	if r.Source == "" && r.At.IsZero() && r.Revision <= 0 {
+		return fmt.Errorf("a snapshot source, latest, --at or --revision is required")
+	}
+	if (!r.At.IsZero() || r.Revision > 0) && r.Source != "" && r.Source != sourceLatest {
+		return fmt.Errorf("--at and --revision select the snapshot, do not pass a source")
+	}
+	if (r.BumpRevision != "") != r.MarkCompacted {
+		return fmt.Errorf("--bump-revision and --mark-compacted must be used together")
+	}
+	if r.Plan && !r.clusterRequested() {
+		return fmt.Errorf("--plan requires --member or --members-from-snapshot")
+	}
+	if _, err := r.memberLayout(r.Name); err != nil {
+		return err
+	}
+
+	// Members given on the command line can be planned without the snapshot
+	if r.Plan && len(r.Member) > 0 {
+		members, err := r.restoreMembers("")
+		if err != nil {
+			return err
+		}
+		return r.restoreCluster("", members, 0)
+	}
+
 	log.Info(PKG_CMD, "Starting restore operation")
 
+	// Downloads, decompressed copies and replayed snapshots never go to the snapshot directory,
+	// where retention and listing would take them for managed snapshots
+	workDir, err := r.scratchDir(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.removeArtifacts(workDir)
+
+	if r.selectionRequested() {
+		r.Source, err = r.selectSnapshot(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to select snapshot: %w", err)
+		}
+	}
+
 	var snapshotPath string
-	var err error
 
 	// Determine snapshot source: s3:// URL, local file, or S3 key
 	if strings.HasPrefix(r.Source, "s3://") {
-		snapshotPath, err = r.downloadFromS3URL(ctx, r.Source)
+		snapshotPath, err = r.downloadFromS3URL(ctx, r.Source, workDir)
 	} else {
 		// Check if local file exists (with compression resolution)
 		resolvedPath, found := compression.ResolveCompressedFile(r.Source)
@@ -42,7 +106,7 @@ func (r *RestoreCmd) Run(ctx *CLIContext) error {
 		} else {
 			// Local file missing/empty - attempt S3 download
 			log.Warnf(PKG_CMD, "Local file '%s' not found or empty, attempting to download", r.Source)
-			snapshotPath, err = r.downloadFromS3Key(ctx, r.Source)
+			snapshotPath, err = r.downloadFromS3Key(ctx, r.Source, workDir)
 		}
 	}
 
@@ -54,7 +118,7 @@ func (r *RestoreCmd) Run(ctx *CLIContext) error {
 	finalSnapshotPath := snapshotPath
 	if compression.IsCompressed(snapshotPath) {
 		// Generate decompressed filename
-		decompressedPath := strings.TrimSuffix(snapshotPath, filepath.Ext(snapshotPath))
+		decompressedPath := filepath.Join(workDir, strings.TrimSuffix(filepath.Base(snapshotPath), filepath.Ext(snapshotPath)))
 		if !strings.HasSuffix(decompressedPath, ".db") {
 			decompressedPath += ".db"
 		}
@@ -69,6 +133,61 @@ func (r *RestoreCmd) Run(ctx *CLIContext) error {
 
 	}
 
+	revisionBump, err := r.revisionBump(manifest.Name(snapshotPath), time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Members are read before replaying changes, the replayed snapshot only knows the scratch member
+	var members []etcd.RestoreMember
+	if r.clusterRequested() {
+		members, err = r.restoreMembers(finalSnapshotPath)
+		if err != nil {
+			return err
+		}
+		if r.Plan {
+			return r.restoreCluster("", members, 0)
+		}
+	}
+
+	// Data directories are checked before anything is replayed or written
+	targets, err := r.preflight(finalSnapshotPath, members, time.Now())
+	if err != nil {
+		return err
+	}
+	if r.DryRun {
+		if err := r.printPlan(finalSnapshotPath, members, targets, revisionBump); err != nil {
+			return err
+		}
+	}
+	if err := targets.err(); err != nil {
+		return err
+	}
+	if r.DryRun {
+		return nil
+	}
+
+	// Replay recorded changes on top of the snapshot
+	if r.pointInTimeRequested() {
+		finalSnapshotPath, err = r.pointInTime(ctx, finalSnapshotPath, workDir)
+		if err != nil {
+			return fmt.Errorf("point-in-time recovery failed: %w", err)
+		}
+	}
+
+	if err := targets.backup(); err != nil {
+		return err
+	}
+
+	if r.clusterRequested() {
+		return r.restoreCluster(finalSnapshotPath, members, revisionBump)
+	}
+
+	layout, err := r.memberLayout(r.Name)
+	if err != nil {
+		return err
+	}
+
 	// Restore snapshot using etcdutl (offline operation - no client connection needed)
 	restoreOpts := etcd.RestoreOptions{
 		SnapshotPath:             finalSnapshotPath,
@@ -76,7 +195,11 @@ func (r *RestoreCmd) Run(ctx *CLIContext) error {
 		Name:                     r.Name,
 		InitialCluster:           r.InitialCluster,
 		InitialAdvertisePeerURLs: r.InitialAdvertisePeerURLs,
+		InitialClusterToken:      r.InitialClusterToken,
 		SkipHashCheck:            r.SkipHashCheck,
+		RevisionBump:             revisionBump,
+		MarkCompacted:            r.MarkCompacted,
+		Layout:                   layout,
 	}
 
 	if err := etcd.RestoreSnapshot(context.Background(), restoreOpts); err != nil {
@@ -84,27 +207,59 @@ func (r *RestoreCmd) Run(ctx *CLIContext) error {
 	}
 
 	log.Infof(PKG_CMD, "Restore completed successfully to %s", r.DataDir)
+	// --wal-dir and --snapshot-count only take effect when etcd is started with them
+	printEtcdFlags(etcd.RestoreMember{Name: r.Name, PeerURLs: r.InitialAdvertisePeerURLs}, r.DataDir, r.InitialCluster, r.InitialClusterToken, layout)
 	return nil
 }
 
+// scratchDir creates the directory restore artefacts are written to, under --scratch-dir.
+// It must not be the snapshot directory, a directory inside it is never listed.
+func (r *RestoreCmd) scratchDir(ctx *CLIContext) (string, error) {
+	if r.ScratchDir != "" {
+		if filepath.Clean(r.ScratchDir) == filepath.Clean(ctx.Config.Etcd.SnapshotDir) {
+			return "", fmt.Errorf("--scratch-dir must not be the snapshot directory %s", ctx.Config.Etcd.SnapshotDir)
+		}
+		if err := os.MkdirAll(r.ScratchDir, 0700); err != nil {
+			return "", fmt.Errorf("failed to create scratch directory: %w", err)
+		}
+	}
+
+	workDir, err := os.MkdirTemp(r.ScratchDir, "etcd2s3-restore-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create work directory: %w", err)
+	}
+	return workDir, nil
+}
+
+// removeArtifacts removes the work directory, unless --keep-artifacts is set
+func (r *RestoreCmd) removeArtifacts(workDir string) {
+	if r.KeepArtifacts {
+		log.Infof(PKG_CMD, "Restore artifacts kept in %s", workDir)
+		return
+	}
+	if err := os.RemoveAll(workDir); err != nil {
+		log.Warnf(PKG_CMD, "Failed to remove restore artifacts in %s: %v", workDir, err)
+	}
+}
+
 // downloadFromS3URL downloads a snapshot from an s3:// URL
-func (r *RestoreCmd) downloadFromS3URL(ctx *CLIContext, s3URL string) (string, error) {
+func (r *RestoreCmd) downloadFromS3URL(ctx *CLIContext, s3URL, workDir string) (string, error) {
 	// Extract S3 key from s3:// URL
 	s3Key := s3URL[5:] // Remove "s3://" prefix
 	if idx := strings.Index(s3Key, "/"); idx > 0 {
 		s3Key = s3Key[idx+1:] // Remove bucket name
 	}
-	return r.downloadSnapshot(ctx, s3Key)
+	return r.downloadSnapshot(ctx, s3Key, workDir)
 }
 
 // downloadFromS3Key downloads a snapshot using an S3 key
-func (r *RestoreCmd) downloadFromS3Key(ctx *CLIContext, source string) (string, error) {
+func (r *RestoreCmd) downloadFromS3Key(ctx *CLIContext, source, workDir string) (string, error) {
 	s3Key := filepath.Base(source)
-	return r.downloadSnapshot(ctx, s3Key)
+	return r.downloadSnapshot(ctx, s3Key, workDir)
 }
 
-// downloadSnapshot downloads a snapshot from S3 with validation and cleanup
-func (r *RestoreCmd) downloadSnapshot(ctx *CLIContext, s3Key string) (string, error) {
+// downloadSnapshot downloads a snapshot from S3 into workDir with validation and cleanup
+func (r *RestoreCmd) downloadSnapshot(ctx *CLIContext, s3Key, workDir string) (string, error) {
 	s3Client, err := ctx.GetS3Client()
 	if err != nil {
 		return "", err
@@ -121,7 +276,7 @@ func (r *RestoreCmd) downloadSnapshot(ctx *CLIContext, s3Key string) (string, er
 
 	// Update the key to the resolved version
 	actualKey := resolvedKey
-	snapshotPath := filepath.Join(ctx.Config.Etcd.SnapshotDir, filepath.Base(actualKey))
+	snapshotPath := filepath.Join(workDir, filepath.Base(actualKey))
 
 	// Build display URL for logging - show what the user would see with prefix
 	displayKey := actualKey
@@ -144,6 +299,11 @@ func (r *RestoreCmd) downloadSnapshot(ctx *CLIContext, s3Key string) (string, er
 		return "", fmt.Errorf("downloaded snapshot file is empty or invalid")
 	}
 
+	// The manifest is optional, it carries the metadata for --bump-revision auto
+	if err := s3Client.Download(context.Background(), manifest.Name(actualKey), manifest.Name(snapshotPath)); err != nil {
+		log.Debugf(PKG_CMD, "No manifest for %s: %v", actualKey, err)
+	}
+
 	log.Infof(PKG_CMD, "Snapshot downloaded to: %s", snapshotPath)
 	return snapshotPath, nil
 }
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/thedataflows/etcd2s3/pkg/manifest"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+const (
+	// autoBumpFactor is the safety margin applied to the revisions estimated since the snapshot
+	autoBumpFactor = 2
+	// minAutoRevisionBump is the smallest automatic bump, covering bursts an average hides
+	minAutoRevisionBump = 10000
+	// fallbackRevisionBump is used when the snapshot has no metadata to estimate from, the
+	// amount suggested for Kubernetes restores
+	fallbackRevisionBump = 1000000000
+)
+
+// revisionBump resolves --bump-revision, reading the snapshot manifest in auto mode
+func (r *RestoreCmd) revisionBump(manifestPath string, now time.Time) (uint64, error) {
+	switch r.BumpRevision {
+	case "":
+		return 0, nil
+	case "auto":
+		m, err := manifest.Load(manifestPath)
+		if err != nil {
+			log.Warnf(PKG_CMD, "Cannot estimate the revision bump, using %d: %v", uint64(fallbackRevisionBump), err)
+			return fallbackRevisionBump, nil
+		}
+		bump := autoRevisionBump(m, now)
+		log.Logger.Info().Str(log.KEY_PKG, PKG_CMD).Time("created_at", m.CreatedAt).Float64("write_rate", m.WriteRate).Uint64("revision_bump", bump).Msg("Estimated revision bump")
+		return bump, nil
+	default:
+		bump, err := strconv.ParseUint(r.BumpRevision, 10, 64)
+		if err != nil || bump == 0 {
+			return 0, fmt.Errorf("invalid --bump-revision %q, expected a positive number or auto", r.BumpRevision)
+		}
+		return bump, nil
+	}
+}
+
+// autoRevisionBump estimates how many revisions the cluster wrote since the snapshot was
+// taken and doubles it. Snapshots without a recorded write rate get the fallback bump.
+func autoRevisionBump(m *manifest.Manifest, now time.Time) uint64 {
+	if m.WriteRate <= 0 || m.CreatedAt.IsZero() {
+		return fallbackRevisionBump
+	}
+	age := max(now.Sub(m.CreatedAt), 0)
+	bump := math.Ceil(m.WriteRate * age.Seconds() * autoBumpFactor)
+	return max(uint64(bump), minAutoRevisionBump)
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+	"github.com/thedataflows/etcd2s3/pkg/manifest"
+)
+
+func TestAutoRevisionBump(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		manifest manifest.Manifest
+		expected uint64
+	}{
+		{name: "one hour at 100/s", manifest: manifest.Manifest{CreatedAt: now.Add(-time.Hour), WriteRate: 100}, expected: 720000},
+		{name: "floor", manifest: manifest.Manifest{CreatedAt: now.Add(-time.Minute), WriteRate: 1}, expected: minAutoRevisionBump},
+		{name: "no write rate", manifest: manifest.Manifest{CreatedAt: now.Add(-time.Hour)}, expected: fallbackRevisionBump},
+		{name: "created in the future", manifest: manifest.Manifest{CreatedAt: now.Add(time.Hour), WriteRate: 100}, expected: minAutoRevisionBump},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, autoRevisionBump(&tt.manifest, now), tt.name)
+	}
+}
+
+func TestRestoreRevisionBump(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.Config{})
+	srv.PutKeys(t, map[string]string{"/a": "1"})
+
+	ctx := newTestCLIContext(t, srv)
+	require.NoError(t, (&SnapshotCmd{Name: "first", Compression: "none"}).Run(ctx))
+	for range 10 {
+		srv.PutKeys(t, map[string]string{"/a": "2"})
+	}
+	require.NoError(t, (&SnapshotCmd{Name: "bump", Compression: "zstd"}).Run(ctx))
+
+	source := filepath.Join(ctx.Config.Etcd.SnapshotDir, "bump.db")
+	m, err := manifest.Load(manifest.Name(source + ".zst"))
+	require.NoError(t, err)
+	assert.Positive(t, m.WriteRate, "measured against the first snapshot")
+
+	// Without --mark-compacted the bump is refused
+	assert.Error(t, (&RestoreCmd{Source: source, DataDir: t.TempDir(), BumpRevision: "1000"}).Run(ctx))
+	assert.Error(t, (&RestoreCmd{Source: source, DataDir: t.TempDir(), BumpRevision: "lots", MarkCompacted: true}).Run(ctx))
+
+	srv.Stop()
+
+	peerURL := etcdtest.FreeURL(t)
+	dataDir := filepath.Join(t.TempDir(), "restored")
+	restoreCmd := &RestoreCmd{
+		Source:                   source,
+		DataDir:                  dataDir,
+		Name:                     "restored",
+		InitialCluster:           "restored=" + peerURL,
+		InitialAdvertisePeerURLs: []string{peerURL},
+		BumpRevision:             "1000",
+		MarkCompacted:            true,
+	}
+	require.NoError(t, restoreCmd.Run(ctx))
+
+	restored := etcdtest.Start(t, etcdtest.Config{Name: "restored", DataDir: dataDir, PeerURL: peerURL})
+	assert.Equal(t, map[string]string{"/a": "2"}, restored.GetKeys(t, "/"))
+
+	client, err := etcd.NewClient(appconfig.EtcdConfig{Endpoints: []string{restored.Endpoint}})
+	require.NoError(t, err)
+	defer client.Close()
+	revision, err := client.Revision(context.Background())
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, revision, m.Revision+1000)
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	"github.com/thedataflows/etcd2s3/pkg/snapshotdb"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// clusterRequested reports whether every member of a cluster should be restored
+func (r *RestoreCmd) clusterRequested() bool {
+	return len(r.Member) > 0 || r.MembersFromSnapshot
+}
+
+// restoreMembers returns the members given on the command line, or the voting members
+// recorded in the uncompressed snapshot
+func (r *RestoreCmd) restoreMembers(snapshotPath string) ([]etcd.RestoreMember, error) {
+	var members []etcd.RestoreMember
+	if len(r.Member) > 0 {
+		for _, value := range r.Member {
+			member, err := etcd.ParseRestoreMember(value)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, member)
+		}
+		return members, nil
+	}
+
+	db, err := snapshotdb.Open(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	recorded, err := db.Members()
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range recorded {
+		if member.IsLearner {
+			log.Warnf(PKG_CMD, "Skipping learner %s (%x), add it back after the cluster is up", member.Name, member.ID)
+			continue
+		}
+		if member.Name == "" {
+			return nil, fmt.Errorf("member %x in the snapshot has no name, pass the members with --member", member.ID)
+		}
+		members = append(members, etcd.RestoreMember{Name: member.Name, PeerURLs: member.PeerURLs, ClientURLs: member.ClientURLs})
+	}
+	return members, nil
+}
+
+// memberDataDir returns the data directory a member is restored to in cluster mode
+func (r *RestoreCmd) memberDataDir(name string) string {
+	return filepath.Join(r.DataDir, name)
+}
+
+// printEtcdFlags prints the etcd command line that starts a restored member
+func printEtcdFlags(member etcd.RestoreMember, dataDir, initialCluster, token string, layout etcd.MemberLayout) {
+	fmt.Printf("# %s\netcd %s\n\n", member.Name, strings.Join(member.EtcdFlags(dataDir, initialCluster, token, layout), " \\\n  "))
+}
+
+// restoreCluster restores a data directory per member under --data-dir and prints the
+// etcd flags every member has to be started with. With --plan only the flags are printed.
+func (r *RestoreCmd) restoreCluster(snapshotPath string, members []etcd.RestoreMember, revisionBump uint64) error {
+	initialCluster, err := etcd.InitialCluster(members)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		dataDir := r.memberDataDir(member.Name)
+		layout, err := r.memberLayout(member.Name)
+		if err != nil {
+			return err
+		}
+		if !r.Plan {
+			log.Logger.Info().Str(log.KEY_PKG, PKG_CMD).Str("member", member.Name).Strs("peer_urls", member.PeerURLs).Str("data_dir", dataDir).Msg("Restoring member")
+
+			err := etcd.RestoreSnapshot(context.Background(), etcd.RestoreOptions{
+				SnapshotPath:             snapshotPath,
+				DataDir:                  dataDir,
+				Name:                     member.Name,
+				InitialCluster:           initialCluster,
+				InitialAdvertisePeerURLs: member.PeerURLs,
+				InitialClusterToken:      r.InitialClusterToken,
+				SkipHashCheck:            r.SkipHashCheck,
+				RevisionBump:             revisionBump,
+				MarkCompacted:            r.MarkCompacted,
+				Layout:                   layout,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to restore member %s: %w", member.Name, err)
+			}
+		}
+
+		printEtcdFlags(member, dataDir, initialCluster, r.InitialClusterToken, layout)
+	}
+
+	if r.Plan {
+		log.Infof(PKG_CMD, "Planned restore of %d members, nothing was written", len(members))
+	} else {
+		log.Infof(PKG_CMD, "Restore of %d members completed successfully to %s", len(members), r.DataDir)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+	"github.com/thedataflows/etcd2s3/pkg/snapshotdb"
+)
+
+func TestRestoreCluster(tMain *testing.T) {
+	srv := etcdtest.Start(tMain, etcdtest.Config{Name: "original"})
+	srv.PutKeys(tMain, map[string]string{"/a": "1"})
+
+	ctx := newTestCLIContext(tMain, srv)
+	require.NoError(tMain, (&SnapshotCmd{Name: "cluster", Compression: "zstd"}).Run(ctx))
+	source := filepath.Join(ctx.Config.Etcd.SnapshotDir, "cluster.db")
+
+	// restoredMembers reads the membership written to a restored data directory
+	restoredMembers := func(t *testing.T, dataDir string) map[string][]string {
+		db, err := snapshotdb.Open(filepath.Join(dataDir, "member", "snap", "db"))
+		require.NoError(t, err)
+		defer db.Close()
+
+		members, err := db.Members()
+		require.NoError(t, err)
+		result := make(map[string][]string)
+		for _, member := range members {
+			result[member.Name] = member.PeerURLs
+		}
+		return result
+	}
+
+	tMain.Run("members", func(t *testing.T) {
+		dataDir := t.TempDir()
+		restoreCmd := &RestoreCmd{
+			Source:              source,
+			DataDir:             dataDir,
+			InitialClusterToken: "restored",
+			Member: []string{
+				"a=http://10.0.0.1:2380,http://a.example:2380",
+				"b=http://10.0.0.2:2380",
+				"c=http://10.0.0.3:2380",
+			},
+		}
+		require.NoError(t, restoreCmd.Run(ctx))
+
+		expected := map[string][]string{
+			"a": {"http://10.0.0.1:2380", "http://a.example:2380"},
+			"b": {"http://10.0.0.2:2380"},
+			"c": {"http://10.0.0.3:2380"},
+		}
+		for _, name := range []string{"a", "b", "c"} {
+			assert.Equal(t, expected, restoredMembers(t, filepath.Join(dataDir, name)), name)
+		}
+	})
+
+	tMain.Run("members from snapshot", func(t *testing.T) {
+		dataDir := t.TempDir()
+		restoreCmd := &RestoreCmd{Source: source, DataDir: dataDir, MembersFromSnapshot: true}
+		require.NoError(t, restoreCmd.Run(ctx))
+		assert.Equal(t, map[string][]string{"original": {srv.PeerURL}}, restoredMembers(t, filepath.Join(dataDir, "original")))
+	})
+
+	tMain.Run("plan", func(t *testing.T) {
+		dataDir := filepath.Join(t.TempDir(), "plan")
+		restoreCmd := &RestoreCmd{Source: source, DataDir: dataDir, Member: []string{"a=http://10.0.0.1:2380"}, Plan: true}
+		require.NoError(t, restoreCmd.Run(ctx))
+		assert.NoDirExists(t, dataDir)
+	})
+
+	tMain.Run("plan requires members", func(t *testing.T) {
+		restoreCmd := &RestoreCmd{Source: source, DataDir: t.TempDir(), Plan: true}
+		assert.Error(t, restoreCmd.Run(ctx))
+	})
+
+	tMain.Run("invalid member", func(t *testing.T) {
+		restoreCmd := &RestoreCmd{Source: source, DataDir: t.TempDir(), Member: []string{"http://10.0.0.1:2380"}}
+		assert.Error(t, restoreCmd.Run(ctx))
+	})
+}
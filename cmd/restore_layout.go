@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+)
+
+// memberLayout returns the WAL directory and ownership a member is restored with. In
+// cluster mode every member gets its own WAL directory under --wal-dir, like its data
+// directory under --data-dir.
+func (r *RestoreCmd) memberLayout(name string) (etcd.MemberLayout, error) {
+	layout := etcd.MemberLayout{WALDir: r.WALDir, SnapshotCount: r.SnapshotCount}
+	if r.WALDir != "" && r.clusterRequested() {
+		layout.WALDir = filepath.Join(r.WALDir, name)
+	}
+	if r.UID != "" || r.GID != "" {
+		uid, err := parseID("--uid", r.UID)
+		if err != nil {
+			return etcd.MemberLayout{}, err
+		}
+		gid, err := parseID("--gid", r.GID)
+		if err != nil {
+			return etcd.MemberLayout{}, err
+		}
+		layout.Owner = &etcd.Owner{UID: uid, GID: gid}
+	}
+
+	if r.DirMode != "" {
+		mode, err := strconv.ParseUint(r.DirMode, 8, 32)
+		if err != nil || mode > 0777 {
+			return etcd.MemberLayout{}, fmt.Errorf("invalid --dir-mode %q, expected octal permissions like 0700", r.DirMode)
+		}
+		layout.DirMode = os.FileMode(mode)
+	}
+	return layout, nil
+}
+
+// parseID parses a numeric user or group ID, empty keeps the current one (-1)
+func parseID(flag, value string) (int, error) {
+	if value == "" {
+		return -1, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a numeric ID", flag, value)
+	}
+	return id, nil
+}
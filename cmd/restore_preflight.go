@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/thedataflows/etcd2s3/pkg/datadir"
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// restoreTarget is a data directory a restore writes to
+type restoreTarget struct {
+	*datadir.State
+	// Required is the free space the restore needs on the file system of the directory
+	Required uint64
+	// Backup is where the existing directory is moved to, empty when nothing is moved
+	Backup string
+	// Problem is why the restore is refused, empty when it can go ahead
+	Problem string
+}
+
+type restoreTargets []restoreTarget
+
+// preflight checks every data and WAL directory the restore writes to. Directories held
+// by a running etcd are always refused, non-empty ones unless --force is set, and the file
+// system must have room for the snapshot and the WAL of every member restored to it.
+func (r *RestoreCmd) preflight(snapshotPath string, members []etcd.RestoreMember, now time.Time) (restoreTargets, error) {
+	info, err := os.Stat(snapshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat snapshot: %w", err)
+	}
+
+	dataDirs, walDirs := []string{r.DataDir}, []string{r.WALDir}
+	if r.clusterRequested() {
+		dataDirs, walDirs = dataDirs[:0], walDirs[:0]
+		for _, member := range members {
+			layout, err := r.memberLayout(member.Name)
+			if err != nil {
+				return nil, err
+			}
+			dataDirs = append(dataDirs, r.memberDataDir(member.Name))
+			walDirs = append(walDirs, layout.WALDir)
+		}
+	}
+
+	// Cluster members are restored side by side, each needs its own copy
+	dataRequired := uint64(len(dataDirs)) * uint64(info.Size())
+	walRequired := uint64(len(dataDirs)) * datadir.WALReserve
+	// A separate WAL directory is usually on another file system, it only needs the WAL
+	required := make(map[string]uint64, 2*len(dataDirs))
+	dirs := make([]string, 0, 2*len(dataDirs))
+	for i, dir := range dataDirs {
+		dirs = append(dirs, dir)
+		required[dir] = dataRequired + walRequired
+		if walDirs[i] != "" {
+			dirs = append(dirs, walDirs[i])
+			required[dir] = dataRequired
+			required[walDirs[i]] = walRequired
+		}
+	}
+
+	targets := make(restoreTargets, 0, len(dirs))
+	for _, dir := range dirs {
+		required := required[dir]
+		state, err := datadir.Inspect(dir)
+		if err != nil {
+			return nil, err
+		}
+		target := restoreTarget{State: state, Required: required}
+
+		switch {
+		case state.LockedBy != "":
+			target.Problem = fmt.Sprintf("%s is in use by a running etcd (%s is locked), stop etcd first", dir, state.LockedBy)
+		case !state.Empty && !r.Force:
+			target.Problem = fmt.Sprintf("%s is not empty, use --force to move it to a backup first", dir)
+		case state.FreeBytes < required:
+			target.Problem = fmt.Sprintf("%s has %s free, the restore needs %s", dir, formatSize(int64(state.FreeBytes)), formatSize(int64(required)))
+		}
+		if !state.Empty {
+			target.Backup = datadir.BackupPath(dir, now)
+		}
+
+		log.Logger.Debug().Str(log.KEY_PKG, PKG_CMD).Str("data_dir", dir).Bool("exists", state.Exists).Bool("empty", state.Empty).Str("locked_by", state.LockedBy).Uint64("free_bytes", state.FreeBytes).Uint64("required_bytes", required).Msg("Checked data directory")
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// err joins the problems of all targets
+func (t restoreTargets) err() error {
+	var errs []error
+	for _, target := range t {
+		if target.Problem != "" {
+			errs = append(errs, errors.New(target.Problem))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("restore preflight failed: %w", errors.Join(errs...))
+}
+
+// backup moves existing data directories out of the way. When one cannot be moved, e.g.
+// a WAL directory on another mount point, the ones already moved are moved back so the
+// node is not left half moved.
+func (t restoreTargets) backup() error {
+	var moved restoreTargets
+	for _, target := range t {
+		if target.Backup == "" {
+			continue
+		}
+		if err := datadir.Backup(target.Path, target.Backup); err != nil {
+			return errors.Join(err, moved.rollback())
+		}
+		log.Warnf(PKG_CMD, "Moved existing data directory %s to %s", target.Path, target.Backup)
+		moved = append(moved, target)
+	}
+	return nil
+}
+
+// rollback moves backed up data directories back, in reverse order
+func (t restoreTargets) rollback() error {
+	var errs []error
+	for _, target := range slices.Backward(t) {
+		if err := os.Rename(target.Backup, target.Path); err != nil {
+			errs = append(errs, fmt.Errorf("failed to move %s back to %s: %w", target.Backup, target.Path, err))
+			continue
+		}
+		log.Warnf(PKG_CMD, "Moved data directory %s back to %s", target.Backup, target.Path)
+	}
+	return errors.Join(errs...)
+}
+
+// printPlan prints what the restore would do
+func (r *RestoreCmd) printPlan(snapshotPath string, members []etcd.RestoreMember, targets restoreTargets, revisionBump uint64) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintf(w, "Source:\t%s\n", r.Source)
+	if info, err := os.Stat(snapshotPath); err == nil {
+		_, _ = fmt.Fprintf(w, "Snapshot:\t%s (%s)\n", snapshotPath, formatSize(info.Size()))
+	}
+	switch {
+	case r.ToRevision > 0:
+		_, _ = fmt.Fprintf(w, "Point in time:\treplay recorded changes up to revision %d\n", r.ToRevision)
+	case !r.ToTime.IsZero():
+		_, _ = fmt.Fprintf(w, "Point in time:\treplay recorded changes up to %s\n", r.ToTime.Format(time.RFC3339))
+	}
+	if revisionBump > 0 {
+		_, _ = fmt.Fprintf(w, "Revision bump:\t%d, marked compacted\n", revisionBump)
+	}
+	_, _ = fmt.Fprintf(w, "Cluster token:\t%s\n", r.InitialClusterToken)
+	_, _ = fmt.Fprintln(w)
+
+	_, _ = fmt.Fprintln(w, "DIRECTORY\tSTATE\tFREE\tNEEDED\tACTION")
+	for _, target := range targets {
+		state := "missing"
+		switch {
+		case target.LockedBy != "":
+			state = "locked"
+		case !target.Empty:
+			state = "not empty"
+		case target.Exists:
+			state = "empty"
+		}
+
+		action := "restore"
+		switch {
+		case target.Problem != "":
+			action = "refused: " + target.Problem
+		case target.Backup != "":
+			action = "move to " + target.Backup + ", restore"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", target.Path, state, formatSize(int64(target.FreeBytes)), formatSize(int64(target.Required)), action)
+	}
+	_, _ = fmt.Fprintln(w)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if !r.clusterRequested() {
+		member := etcd.RestoreMember{Name: r.Name, PeerURLs: r.InitialAdvertisePeerURLs}
+		layout, err := r.memberLayout(member.Name)
+		if err != nil {
+			return err
+		}
+		printEtcdFlags(member, r.DataDir, r.InitialCluster, r.InitialClusterToken, layout)
+		return nil
+	}
+	initialCluster, err := etcd.InitialCluster(members)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		layout, err := r.memberLayout(member.Name)
+		if err != nil {
+			return err
+		}
+		printEtcdFlags(member, r.memberDataDir(member.Name), initialCluster, r.InitialClusterToken, layout)
+	}
+	return nil
+}
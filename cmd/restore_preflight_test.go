@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/datadir"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+)
+
+func TestRestorePreflight(tMain *testing.T) {
+	srv := etcdtest.Start(tMain, etcdtest.Config{})
+	srv.PutKeys(tMain, map[string]string{"/a": "1"})
+
+	ctx := newTestCLIContext(tMain, srv)
+	require.NoError(tMain, (&SnapshotCmd{Name: "preflight", Compression: "none"}).Run(ctx))
+	source := filepath.Join(ctx.Config.Etcd.SnapshotDir, "preflight.db")
+
+	// nonEmptyDataDir returns a data directory holding a stale file
+	nonEmptyDataDir := func(t *testing.T) string {
+		dataDir := filepath.Join(t.TempDir(), "etcd")
+		require.NoError(t, os.MkdirAll(dataDir, 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dataDir, "stale"), []byte("x"), 0600))
+		return dataDir
+	}
+
+	tMain.Run("refuses non-empty data dir", func(t *testing.T) {
+		dataDir := nonEmptyDataDir(t)
+		err := (&RestoreCmd{Source: source, DataDir: dataDir}).Run(ctx)
+		require.ErrorContains(t, err, "--force")
+		assert.FileExists(t, filepath.Join(dataDir, "stale"))
+	})
+
+	tMain.Run("force moves data dir to a backup", func(t *testing.T) {
+		dataDir := nonEmptyDataDir(t)
+		require.NoError(t, (&RestoreCmd{Source: source, DataDir: dataDir, Force: true}).Run(ctx))
+
+		assert.DirExists(t, filepath.Join(dataDir, "member", "snap"))
+		assert.NoFileExists(t, filepath.Join(dataDir, "stale"))
+		backups, err := filepath.Glob(dataDir + ".backup-*")
+		require.NoError(t, err)
+		require.Len(t, backups, 1)
+		assert.FileExists(t, filepath.Join(backups[0], "stale"))
+	})
+
+	tMain.Run("refuses data dir in use", func(t *testing.T) {
+		err := (&RestoreCmd{Source: source, DataDir: srv.DataDir, Force: true}).Run(ctx)
+		require.ErrorContains(t, err, "running etcd")
+		assert.DirExists(t, srv.DataDir)
+	})
+
+	tMain.Run("separate WAL dir", func(t *testing.T) {
+		dataDir := filepath.Join(t.TempDir(), "etcd")
+		walDir := filepath.Join(t.TempDir(), "wal")
+		cmd := &RestoreCmd{
+			Source:        source,
+			DataDir:       dataDir,
+			WALDir:        walDir,
+			SnapshotCount: 50000,
+			UID:           strconv.Itoa(os.Getuid()),
+			DirMode:       "0750",
+		}
+		require.NoError(t, cmd.Run(ctx))
+
+		assert.NoDirExists(t, filepath.Join(dataDir, "member", "wal"))
+		wals, err := filepath.Glob(filepath.Join(walDir, "*.wal"))
+		require.NoError(t, err)
+		assert.NotEmpty(t, wals)
+		info, err := os.Stat(walDir)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+
+		// The WAL dir is checked like the data dir
+		err = (&RestoreCmd{Source: source, DataDir: filepath.Join(t.TempDir(), "etcd"), WALDir: walDir}).Run(ctx)
+		assert.ErrorContains(t, err, walDir+" is not empty")
+	})
+
+	tMain.Run("invalid layout", func(t *testing.T) {
+		dataDir := filepath.Join(t.TempDir(), "etcd")
+		assert.ErrorContains(t, (&RestoreCmd{Source: source, DataDir: dataDir, DirMode: "rwx"}).Run(ctx), "--dir-mode")
+		assert.ErrorContains(t, (&RestoreCmd{Source: source, DataDir: dataDir, GID: "etcd"}).Run(ctx), "--gid")
+		assert.NoDirExists(t, dataDir)
+	})
+
+	tMain.Run("dry run writes nothing", func(t *testing.T) {
+		dataDir := nonEmptyDataDir(t)
+		require.NoError(t, (&RestoreCmd{Source: source, DataDir: dataDir, Force: true, DryRun: true}).Run(ctx))
+
+		assert.FileExists(t, filepath.Join(dataDir, "stale"))
+		backups, err := filepath.Glob(dataDir + ".backup-*")
+		require.NoError(t, err)
+		assert.Empty(t, backups)
+	})
+
+	tMain.Run("dry run reports problems", func(t *testing.T) {
+		err := (&RestoreCmd{Source: source, DataDir: nonEmptyDataDir(t), DryRun: true}).Run(ctx)
+		assert.ErrorContains(t, err, "not empty")
+	})
+}
+
+func TestRestoreTargetsBackup(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "etcd")
+	walDir := filepath.Join(t.TempDir(), "wal")
+	for _, dir := range []string{dataDir, walDir} {
+		require.NoError(t, os.MkdirAll(dir, 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "stale"), []byte("x"), 0600))
+	}
+	// The WAL dir cannot be moved, its backup path is taken
+	require.NoError(t, os.MkdirAll(walDir+".backup", 0700))
+
+	targets := restoreTargets{
+		{State: &datadir.State{Path: dataDir}, Backup: dataDir + ".backup"},
+		{State: &datadir.State{Path: walDir}, Backup: walDir + ".backup"},
+	}
+	require.ErrorContains(t, targets.backup(), "already exists")
+	assert.FileExists(t, filepath.Join(dataDir, "stale"), "data dir moved back")
+	assert.NoDirExists(t, dataDir+".backup")
+	assert.FileExists(t, filepath.Join(walDir, "stale"))
+}
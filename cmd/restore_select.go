@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/thedataflows/etcd2s3/pkg/manifest"
+	"github.com/thedataflows/etcd2s3/pkg/retention"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// sourceLatest selects the newest snapshot as restore source
+const sourceLatest = "latest"
+
+// selectionRequested reports whether the snapshot is selected rather than named
+func (r *RestoreCmd) selectionRequested() bool {
+	return r.Source == sourceLatest || !r.At.IsZero() || r.Revision > 0
+}
+
+// selectSnapshot picks the snapshot to restore by --at and --revision, the newest one
+// when neither is set
+func (r *RestoreCmd) selectSnapshot(ctx *CLIContext) (string, error) {
+	return selectSnapshot(ctx, r.At, r.Revision)
+}
+
+// selectSnapshot picks a snapshot among local and S3 snapshots, merged by name like
+// unified retention: the newest one, the newest taken at or before at, or the newest
+// whose manifest revision is at or below revision. A local copy is preferred over
+// downloading.
+func selectSnapshot(ctx *CLIContext, at time.Time, revision int64) (string, error) {
+	retentionMgr := ctx.GetRetentionManager()
+
+	localSnapshots, err := retentionMgr.GetLocalSnapshots(ctx.Config.Etcd.SnapshotDir)
+	if err != nil {
+		return "", err
+	}
+	var s3Snapshots []retention.SnapshotFile
+	s3Client := ctx.GetS3ClientOrNil()
+	if s3Client != nil {
+		s3Snapshots, err = retentionMgr.GetS3Snapshots(context.Background(), s3Client)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	local := make(map[string]retention.SnapshotFile, len(localSnapshots))
+	for _, snapshot := range localSnapshots {
+		local[snapshot.Name] = snapshot
+	}
+
+	for _, snapshot := range retentionMgr.GetUnifiedSnapshots(localSnapshots, s3Snapshots) {
+		if !at.IsZero() && snapshot.Created().After(at) {
+			continue
+		}
+		if revision > 0 {
+			snapshotRevision, err := snapshotRevision(ctx, snapshot, local)
+			if err != nil {
+				log.Debugf(PKG_CMD, "Skipping %s: %v", snapshot.Name, err)
+				continue
+			}
+			if snapshotRevision > revision {
+				continue
+			}
+		}
+
+		log.Logger.Info().Str(log.KEY_PKG, PKG_CMD).Str("snapshot", snapshot.Name).Time("created", snapshot.Created()).Bool("remote", snapshot.IsRemote).Msg("Selected snapshot")
+		if localCopy, ok := local[snapshot.Name]; ok {
+			return localCopy.Path, nil
+		}
+		return snapshot.Path, nil
+	}
+
+	switch {
+	case revision > 0:
+		return "", fmt.Errorf("no snapshot with a manifest at or before revision %d", revision)
+	case !at.IsZero():
+		return "", fmt.Errorf("no snapshot taken at or before %s", at.Format(time.RFC3339))
+	default:
+		return "", fmt.Errorf("no snapshots found")
+	}
+}
+
+// snapshotRevision reads the revision of a snapshot from its manifest, locally when
+// there is a local copy, otherwise from S3
+func snapshotRevision(ctx *CLIContext, snapshot retention.SnapshotFile, local map[string]retention.SnapshotFile) (int64, error) {
+	if localCopy, ok := local[snapshot.Name]; ok {
+		if m, err := manifest.Load(manifest.Name(localCopy.Path)); err == nil {
+			return m.Revision, nil
+		}
+	}
+	if !snapshot.IsRemote {
+		return 0, fmt.Errorf("no manifest")
+	}
+
+	s3Client, err := ctx.GetS3Client()
+	if err != nil {
+		return 0, err
+	}
+	data, err := s3Client.ReadObject(context.Background(), manifest.Name(snapshot.Path))
+	if err != nil {
+		return 0, err
+	}
+	m, err := manifest.Parse(data)
+	if err != nil {
+		return 0, err
+	}
+	return m.Revision, nil
+}
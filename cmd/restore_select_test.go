@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+	"github.com/thedataflows/etcd2s3/pkg/manifest"
+)
+
+func TestRestoreSelectSnapshot(tMain *testing.T) {
+	srv := etcdtest.Start(tMain, etcdtest.Config{})
+	ctx := newTestCLIContext(tMain, srv)
+
+	// Three snapshots taken an hour apart, each after one more write. Modification
+	// times run the other way, as after copying the files, and must be ignored.
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	revisions := make(map[string]int64)
+	for i, name := range []string{"etcd-snapshot-a", "etcd-snapshot-b", "etcd-snapshot-c"} {
+		srv.PutKeys(tMain, map[string]string{"/counter": name})
+		require.NoError(tMain, (&SnapshotCmd{Name: name, Compression: "zstd"}).Run(ctx))
+
+		path := filepath.Join(ctx.Config.Etcd.SnapshotDir, name+".db.zst")
+		m, err := manifest.Load(manifest.Name(path))
+		require.NoError(tMain, err)
+		m.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		require.NoError(tMain, m.Save(manifest.Name(path)))
+		modTime := base.Add(time.Duration(10-i) * time.Hour)
+		require.NoError(tMain, os.Chtimes(path, modTime, modTime))
+		revisions[name] = m.Revision
+	}
+
+	tests := []struct {
+		name     string
+		cmd      RestoreCmd
+		expected string
+		wantErr  bool
+	}{
+		{name: "latest", cmd: RestoreCmd{Source: sourceLatest}, expected: "etcd-snapshot-c"},
+		{name: "at exact time", cmd: RestoreCmd{At: base.Add(time.Hour)}, expected: "etcd-snapshot-b"},
+		{name: "at between snapshots", cmd: RestoreCmd{At: base.Add(90 * time.Minute)}, expected: "etcd-snapshot-b"},
+		{name: "at before all snapshots", cmd: RestoreCmd{At: base.Add(-time.Minute)}, wantErr: true},
+		{name: "revision of a snapshot", cmd: RestoreCmd{Revision: revisions["etcd-snapshot-a"]}, expected: "etcd-snapshot-a"},
+		{name: "revision after the last snapshot", cmd: RestoreCmd{Revision: revisions["etcd-snapshot-c"] + 100}, expected: "etcd-snapshot-c"},
+		{name: "revision before all snapshots", cmd: RestoreCmd{Revision: 1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tMain.Run(tt.name, func(t *testing.T) {
+			source, err := tt.cmd.selectSnapshot(ctx)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, filepath.Join(ctx.Config.Etcd.SnapshotDir, tt.expected+".db.zst"), source)
+		})
+	}
+
+	tMain.Run("source and selection", func(t *testing.T) {
+		assert.Error(t, (&RestoreCmd{Source: "etcd-snapshot-a.db", Revision: 5}).Run(ctx))
+		assert.Error(t, (&RestoreCmd{}).Run(ctx))
+	})
+}
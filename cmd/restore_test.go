@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+)
+
+func TestRestoreArtifacts(tMain *testing.T) {
+	srv := etcdtest.Start(tMain, etcdtest.Config{})
+	srv.PutKeys(tMain, map[string]string{"/a": "1"})
+
+	ctx := newTestCLIContext(tMain, srv)
+	require.NoError(tMain, (&SnapshotCmd{Name: "artifacts", Compression: "zstd"}).Run(ctx))
+	source := filepath.Join(ctx.Config.Etcd.SnapshotDir, "artifacts.db.zst")
+
+	// snapshotDirEntries lists the snapshot directory, which a restore must leave alone
+	snapshotDirEntries := func(t *testing.T) []string {
+		entries, err := os.ReadDir(ctx.Config.Etcd.SnapshotDir)
+		require.NoError(t, err)
+		names := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+	before := snapshotDirEntries(tMain)
+
+	tMain.Run("removed after restore", func(t *testing.T) {
+		scratchDir := t.TempDir()
+		cmd := &RestoreCmd{Source: source, DataDir: filepath.Join(t.TempDir(), "etcd"), ScratchDir: scratchDir}
+		require.NoError(t, cmd.Run(ctx))
+
+		assert.Equal(t, before, snapshotDirEntries(t))
+		entries, err := os.ReadDir(scratchDir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	tMain.Run("removed after failure", func(t *testing.T) {
+		scratchDir := t.TempDir()
+		dataDir := filepath.Join(t.TempDir(), "etcd")
+		require.NoError(t, os.MkdirAll(dataDir, 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dataDir, "stale"), []byte("x"), 0600))
+
+		cmd := &RestoreCmd{Source: source, DataDir: dataDir, ScratchDir: scratchDir}
+		require.Error(t, cmd.Run(ctx))
+
+		entries, err := os.ReadDir(scratchDir)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	tMain.Run("kept on request", func(t *testing.T) {
+		scratchDir := t.TempDir()
+		cmd := &RestoreCmd{Source: source, DataDir: filepath.Join(t.TempDir(), "etcd"), ScratchDir: scratchDir, KeepArtifacts: true}
+		require.NoError(t, cmd.Run(ctx))
+
+		kept, err := filepath.Glob(filepath.Join(scratchDir, "etcd2s3-restore-*", "artifacts.db"))
+		require.NoError(t, err)
+		assert.Len(t, kept, 1)
+		assert.Equal(t, before, snapshotDirEntries(t))
+	})
+
+	tMain.Run("scratch dir is not the snapshot dir", func(t *testing.T) {
+		cmd := &RestoreCmd{Source: source, DataDir: filepath.Join(t.TempDir(), "etcd"), ScratchDir: ctx.Config.Etcd.SnapshotDir}
+		assert.ErrorContains(t, cmd.Run(ctx), "--scratch-dir")
+	})
+}
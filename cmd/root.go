@@ -20,8 +20,15 @@ type CLI struct {
 	Version   VersionCmd          `kong:"cmd,help='Show version information'"`
 	Snapshot  SnapshotCmd         `kong:"cmd,help='Take a snapshot of etcd and upload to S3'"`
 	Restore   RestoreCmd          `kong:"cmd,help='Restore etcd from a snapshot stored in S3'"`
+	Drill     DrillCmd            `kong:"cmd,help='Restore a snapshot into a scratch member and check it boots with the expected data'"`
 	List      ListCmd             `kong:"cmd,help='List snapshots stored locally and in S3'"`
 	Cleanup   CleanupCmd          `kong:"cmd,help='Delete snapshots based on retention policies'"`
+	Export    ExportCmd           `kong:"cmd,help='Export a key prefix or range to NDJSON and upload to S3'"`
+	Import    ImportCmd           `kong:"cmd,help='Import an NDJSON export into a live cluster'"`
+	Diff      DiffCmd             `kong:"cmd,help='Compare two snapshots, or a snapshot with the live cluster'"`
+	Get       GetCmd              `kong:"cmd,help='Read keys from a snapshot without restoring it'"`
+	Inspect   InspectCmd          `kong:"cmd,help='Show what a snapshot contains without restoring it'"`
+	Watch     WatchCmd            `kong:"cmd,help='Record changes between snapshots for point-in-time recovery'"`
 	Config    appconfig.AppConfig `kong:"embed"`
 }
 
@@ -83,6 +90,13 @@ func Run(version string, args []string) error {
 		return ctx.Run(cliCtx)
 	}
 
+	if err := cli.Config.LoadClusters(); err != nil {
+		return err
+	}
+	if err := cli.Config.Validate(); err != nil {
+		return err
+	}
+
 	// Create CLI context with shared config and S3 factory
 	cliCtx := NewCLIContext(version, &cli.Config)
 
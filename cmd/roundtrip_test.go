@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+	"github.com/thedataflows/etcd2s3/pkg/manifest"
+	"github.com/thedataflows/etcd2s3/pkg/segment"
+)
+
+const defaultTestTimeout = 30 * time.Second
+
+// newTestCLIContext returns a CLI context pointing at the given server with a temp snapshot dir
+func newTestCLIContext(t *testing.T, srv *etcdtest.Server) *CLIContext {
+	t.Helper()
+
+	return NewCLIContext("test", &appconfig.AppConfig{
+		Etcd: appconfig.EtcdConfig{
+			Endpoints:       []string{srv.Endpoint},
+			SnapshotDir:     t.TempDir(),
+			SnapshotTimeout: defaultTestTimeout,
+		},
+	})
+}
+
+func TestSnapshotRestoreRoundTrip(tMain *testing.T) {
+	for _, algorithm := range []string{"none", "zstd", "gzip"} {
+		tMain.Run(algorithm, func(t *testing.T) {
+			srv := etcdtest.Start(t, etcdtest.Config{})
+			keys := map[string]string{
+				"/registry/pods/a": "pod-a",
+				"/registry/pods/b": "pod-b",
+				"/config/x":        "x",
+			}
+			srv.PutKeys(t, keys)
+
+			ctx := newTestCLIContext(t, srv)
+
+			snapshotCmd := &SnapshotCmd{
+				Name:        "roundtrip-snapshot",
+				Compression: algorithm,
+			}
+			require.NoError(t, snapshotCmd.Run(ctx))
+
+			snapshots, err := ctx.GetRetentionManager().GetLocalSnapshots(ctx.Config.Etcd.SnapshotDir)
+			require.NoError(t, err)
+			require.Len(t, snapshots, 1)
+
+			m, err := manifest.Load(manifest.Name(snapshots[0].Path))
+			require.NoError(t, err)
+			assert.Equal(t, snapshots[0].Name, m.Snapshot)
+			assert.Positive(t, m.Revision)
+			assert.Equal(t, len(keys), m.TotalKeys)
+			require.NotNil(t, m.Health)
+			assert.True(t, m.Health.Healthy)
+
+			srv.Stop()
+
+			peerURL := etcdtest.FreeURL(t)
+			dataDir := filepath.Join(t.TempDir(), "restored")
+			restoreCmd := &RestoreCmd{
+				Source:                   snapshots[0].Path,
+				DataDir:                  dataDir,
+				Name:                     "restored",
+				InitialCluster:           "restored=" + peerURL,
+				InitialAdvertisePeerURLs: []string{peerURL},
+			}
+			require.NoError(t, restoreCmd.Run(ctx))
+
+			restored := etcdtest.Start(t, etcdtest.Config{Name: "restored", DataDir: dataDir, PeerURL: peerURL})
+			assert.Equal(t, keys, restored.GetKeys(t, "/"))
+		})
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	source := etcdtest.Start(t, etcdtest.Config{})
+	source.PutKeys(t, map[string]string{
+		"/app-a/config": "a",
+		"/app-a/data/1": "1",
+		"/app-b/config": "b",
+	})
+
+	ctx := newTestCLIContext(t, source)
+	exportCmd := &ExportCmd{
+		Name:        "app-a",
+		Prefix:      "/app-a/",
+		PageSize:    1,
+		Compression: "zstd",
+	}
+	require.NoError(t, exportCmd.Run(ctx))
+
+	exportPath := filepath.Join(ctx.Config.Etcd.SnapshotDir, "app-a.ndjson.zst")
+	require.FileExists(t, exportPath)
+
+	// Exports are not snapshots
+	snapshots, err := ctx.GetRetentionManager().GetLocalSnapshots(ctx.Config.Etcd.SnapshotDir)
+	require.NoError(t, err)
+	assert.Empty(t, snapshots)
+
+	target := etcdtest.Start(t, etcdtest.Config{})
+	target.PutKeys(t, map[string]string{"/app-a/config": "keep"})
+
+	importCmd := &ImportCmd{
+		Source:      exportPath,
+		Mode:        "fail",
+		RewriteFrom: "/app-a/",
+		RewriteTo:   "/app-a-restored/",
+		BatchSize:   100,
+	}
+	require.NoError(t, importCmd.Run(newTestCLIContext(t, target)))
+
+	// Batches etcd would reject are refused before anything is written
+	for _, batchSize := range []int{0, etcd.MaxImportBatchSize + 1} {
+		err := (&ImportCmd{Source: exportPath, Mode: "overwrite", BatchSize: batchSize}).Run(newTestCLIContext(t, target))
+		assert.ErrorContains(t, err, "--batch-size")
+	}
+
+	assert.Equal(t, map[string]string{
+		"/app-a/config":          "keep",
+		"/app-a-restored/config": "a",
+		"/app-a-restored/data/1": "1",
+	}, target.GetKeys(t, "/"))
+}
+
+func TestPointInTimeRecovery(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.Config{})
+	srv.PutKeys(t, map[string]string{"/base": "0"})
+
+	ctx := newTestCLIContext(t, srv)
+	require.NoError(t, (&SnapshotCmd{Name: "base", Compression: "none"}).Run(ctx))
+
+	// Changes after the snapshot
+	client := srv.Client(t)
+	_, err := client.Put(context.Background(), "/k1", "1")
+	require.NoError(t, err)
+	resp, err := client.Put(context.Background(), "/k2", "2")
+	require.NoError(t, err)
+	target := resp.Header.Revision
+	_, err = client.Delete(context.Background(), "/k1")
+	require.NoError(t, err)
+	_, err = client.Put(context.Background(), "/k3", "3")
+	require.NoError(t, err)
+
+	watchCmd := &WatchCmd{
+		SegmentInterval:  time.Second,
+		SegmentMaxEvents: 2,
+		Compression:      "zstd",
+		Duration:         2 * time.Second,
+	}
+	require.NoError(t, watchCmd.Run(ctx))
+
+	segments, err := filepath.Glob(filepath.Join(ctx.Config.Etcd.SnapshotDir, segment.Prefix+"*"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, segments)
+
+	srv.Stop()
+
+	peerURL := etcdtest.FreeURL(t)
+	dataDir := filepath.Join(t.TempDir(), "restored")
+	restoreCmd := &RestoreCmd{
+		Source:                   filepath.Join(ctx.Config.Etcd.SnapshotDir, "base.db"),
+		DataDir:                  dataDir,
+		Name:                     "restored",
+		InitialCluster:           "restored=" + peerURL,
+		InitialAdvertisePeerURLs: []string{peerURL},
+		ToRevision:               target,
+	}
+	require.NoError(t, restoreCmd.Run(ctx))
+
+	restored := etcdtest.Start(t, etcdtest.Config{Name: "restored", DataDir: dataDir, PeerURL: peerURL})
+	assert.Equal(t, map[string]string{"/base": "0", "/k1": "1", "/k2": "2"}, restored.GetKeys(t, "/"))
+}
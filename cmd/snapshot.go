@@ -3,12 +3,14 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/thedataflows/etcd2s3/pkg/compression"
 	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	"github.com/thedataflows/etcd2s3/pkg/manifest"
 	"github.com/thedataflows/etcd2s3/pkg/retention"
 	log "github.com/thedataflows/go-lib-log"
 )
@@ -21,9 +23,19 @@ type SnapshotCmd struct {
 	ApplyRetention bool   `kong:"help='Apply retention policies after snapshot',default=true"`
 	Unified        bool   `kong:"help='Use unified retention evaluation across local and S3',default=true"`
 	Compression    string `kong:"help='Compression algorithm for snapshot',default='zstd',enum='none,bzip2,gzip,lz4,zstd'"`
+	HealthCheck    string `kong:"help='Pre-snapshot cluster health gate (enforce,warn,off)',default='enforce',enum='enforce,warn,off'"`
+	MaxIndexSpread uint64 `kong:"help='Maximum raft index difference between members before the cluster is considered unhealthy',default='1000'"`
+	Compact        bool   `kong:"help='Compact the keyspace before the snapshot'"`
+	CompactRetain  int64  `kong:"help='Number of most recent revisions to keep when compacting',default='1000'"`
+	Defrag         bool   `kong:"help='Defragment the snapshot source member before the snapshot'"`
+	DefragLeader   bool   `kong:"help='Allow defragmenting the snapshot source member when it is the leader'"`
 }
 
 func (s *SnapshotCmd) Run(ctx *CLIContext) error {
+	return ctx.ForEachCluster(s.run)
+}
+
+func (s *SnapshotCmd) run(ctx *CLIContext) error {
 	log.Info(PKG_CMD, "Starting snapshot operation")
 
 	// Create etcd client
@@ -33,10 +45,32 @@ func (s *SnapshotCmd) Run(ctx *CLIContext) error {
 	}
 	defer etcdClient.Close()
 
+	// Gate the snapshot on cluster health
+	var health *etcd.HealthReport
+	if s.HealthCheck != "off" {
+		health = etcdClient.CheckHealth(context.Background(), s.MaxIndexSpread)
+		if health.Healthy {
+			log.Info(PKG_CMD, "Cluster health check passed")
+		} else {
+			for _, problem := range health.Problems {
+				log.Warnf(PKG_CMD, "Cluster health problem: %s", problem)
+			}
+			if s.HealthCheck == "enforce" {
+				return fmt.Errorf("cluster is unhealthy, refusing to take snapshot: %s", strings.Join(health.Problems, "; "))
+			}
+			log.Warn(PKG_CMD, "Cluster is unhealthy, taking snapshot anyway")
+		}
+	}
+
+	defragmented, err := s.prepareMembers(ctx, etcdClient)
+	if err != nil {
+		return err
+	}
+
 	// Generate snapshot name if not provided
 	snapshotName := s.Name
 	if len(snapshotName) == 0 {
-		snapshotName = fmt.Sprintf("etcd-snapshot-%s.db", time.Now().Format("20060102-150405"))
+		snapshotName = fmt.Sprintf("etcd-snapshot-%s.db", time.Now().UTC().Format("20060102-150405Z"))
 	}
 	if filepath.Ext(snapshotName) != ".db" {
 		snapshotName = fmt.Sprintf("%s.db", snapshotName)
@@ -49,33 +83,33 @@ func (s *SnapshotCmd) Run(ctx *CLIContext) error {
 	snapshotCtx, cancel := context.WithTimeout(context.Background(), ctx.Config.Etcd.SnapshotTimeout)
 	defer cancel()
 
-	if err := etcdClient.Snapshot(snapshotCtx, snapshotPath); err != nil {
+	started := time.Now()
+	// The member just defragmented is snapshotted, even if it fell behind meanwhile
+	source, err := etcdClient.SnapshotPreferring(snapshotCtx, snapshotPath, defragmented)
+	if err != nil {
 		return fmt.Errorf("failed to take etcd snapshot: %w", err)
 	}
 
-	log.Logger.Info().Str(log.KEY_PKG, PKG_CMD).Str("file", snapshotPath).Msg("Snapshot saved")
+	log.Logger.Info().Str(log.KEY_PKG, PKG_CMD).Str("file", snapshotPath).Str("endpoint", source.Endpoint).Bool("leader", source.IsLeader()).Msg("Snapshot saved")
 
-	// Apply compression if specified
-	finalSnapshotPath := snapshotPath
-	if strings.ToLower(s.Compression) != "none" && s.Compression != "" {
-		compressedPath := snapshotPath + compression.GetCompressionExt(s.Compression)
-
-		// Time the compression operation
-		compressionStart := time.Now()
-		if err := compression.CompressFile(snapshotPath, compressedPath, s.Compression); err != nil {
-			return fmt.Errorf("failed to compress snapshot: %w", err)
-		}
-
-		log.Logger.Info().Str(log.KEY_PKG, PKG_CMD).Str("algorithm", s.Compression).Str("file", compressedPath).Str("duration", fmt.Sprintf("%s", time.Since(compressionStart))).Msg("Snapshot compressed")
+	snapshotStatus, err := etcd.ReadSnapshotStatus(snapshotPath)
+	if err != nil {
+		return err
+	}
+	writeRate := s.writeRate(ctx, etcdClient, source.ClusterID, snapshotStatus.Revision, started)
 
-		// Remove original uncompressed file
-		if err := etcdClient.RemoveSnapshot(snapshotPath); err != nil {
-			log.Logger.Error().Err(err).Str(log.KEY_PKG, PKG_CMD).Str("file", snapshotPath).Msg("Failed to remove original snapshot")
-		}
+	// Apply compression if specified
+	finalSnapshotPath, err := compressArtifact(snapshotPath, s.Compression)
+	if err != nil {
+		return fmt.Errorf("failed to compress snapshot: %w", err)
+	}
+	// Update snapshot name for S3 upload
+	snapshotName = filepath.Base(finalSnapshotPath)
 
-		finalSnapshotPath = compressedPath
-		// Update snapshot name for S3 upload
-		snapshotName = filepath.Base(compressedPath)
+	// Record snapshot metadata next to the snapshot
+	manifestPath := manifest.Name(finalSnapshotPath)
+	if err := s.writeManifest(manifestPath, finalSnapshotPath, source, snapshotStatus, health, writeRate); err != nil {
+		return err
 	}
 
 	if s.UploadToS3 {
@@ -94,6 +128,10 @@ func (s *SnapshotCmd) Run(ctx *CLIContext) error {
 
 		log.Infof(PKG_CMD, "Snapshot uploaded to S3: s3://%s/%s", ctx.Config.S3.Bucket, s3Key)
 
+		if err := s3Client.Upload(context.Background(), manifestPath, manifest.Name(s3Key)); err != nil {
+			return fmt.Errorf("failed to upload snapshot manifest to S3: %w", err)
+		}
+
 		// Upload any other local snapshots that should be kept but are missing from S3
 		if err := s.uploadMissingSnapshots(ctx); err != nil {
 			log.Warnf(PKG_CMD, "Failed to upload missing local snapshots: %v", err)
@@ -106,12 +144,15 @@ func (s *SnapshotCmd) Run(ctx *CLIContext) error {
 			} else {
 				log.Infof(PKG_CMD, "Local snapshot removed: %s", finalSnapshotPath)
 			}
+			if err := os.Remove(manifestPath); err != nil && !os.IsNotExist(err) {
+				log.Warnf(PKG_CMD, "Failed to remove local snapshot manifest %s: %v", manifestPath, err)
+			}
 		}
 	}
 
 	if s.ApplyRetention {
 		// Apply retention policies
-		retentionManager := retention.NewManager(ctx.Config.Policy)
+		retentionManager := ctx.GetRetentionManager()
 
 		if s.Unified && s.UploadToS3 {
 			// Use unified approach when both local and S3 are involved
@@ -150,6 +191,50 @@ func (s *SnapshotCmd) Run(ctx *CLIContext) error {
 	return nil
 }
 
+// prepareMembers compacts the keyspace and defragments the snapshot source member, when
+// requested. It returns the endpoint of the defragmented member, empty when none was.
+func (s *SnapshotCmd) prepareMembers(ctx *CLIContext, etcdClient *etcd.Client) (string, error) {
+	if s.Compact {
+		compactCtx, cancel := context.WithTimeout(context.Background(), ctx.Config.Etcd.CompactTimeout)
+		defer cancel()
+
+		revision, err := etcdClient.Compact(compactCtx, s.CompactRetain)
+		if err != nil {
+			return "", err
+		}
+		if revision > 0 {
+			log.Infof(PKG_CMD, "Compacted keyspace to revision %d", revision)
+		}
+	}
+
+	if !s.Defrag {
+		return "", nil
+	}
+
+	// Only the member the snapshot will be streamed from is defragmented,
+	// so the rest of the cluster keeps serving while it is blocked
+	candidates, err := etcdClient.SnapshotCandidates(context.Background())
+	if err != nil {
+		return "", err
+	}
+	target := candidates[0]
+	if target.IsLeader() && !s.DefragLeader {
+		log.Warnf(PKG_CMD, "Skipping defragmentation of %s: it is the leader (use --defrag-leader to force)", target.Endpoint)
+		return "", nil
+	}
+
+	defragCtx, cancel := context.WithTimeout(context.Background(), ctx.Config.Etcd.DefragTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := etcdClient.Defragment(defragCtx, target.Endpoint); err != nil {
+		return "", err
+	}
+	log.Logger.Info().Str(log.KEY_PKG, PKG_CMD).Str("endpoint", target.Endpoint).Str("duration", time.Since(start).String()).Msg("Member defragmented")
+
+	return target.Endpoint, nil
+}
+
 // uploadMissingSnapshots uploads local snapshots that should be kept according to retention policy
 // but are missing from S3
 func (s *SnapshotCmd) uploadMissingSnapshots(ctx *CLIContext) error {
@@ -162,7 +247,7 @@ func (s *SnapshotCmd) uploadMissingSnapshots(ctx *CLIContext) error {
 	}
 
 	// Create retention manager to determine which snapshots should be kept
-	retentionManager := retention.NewManager(ctx.Config.Policy)
+	retentionManager := ctx.GetRetentionManager()
 
 	// Get local snapshots
 	localSnapshots, err := retentionManager.GetLocalSnapshots(ctx.Config.Etcd.SnapshotDir)
@@ -182,12 +267,12 @@ func (s *SnapshotCmd) uploadMissingSnapshots(ctx *CLIContext) error {
 		s3SnapshotNames[s3Snap.Name] = true
 	}
 
-	// Use unified retention to determine which snapshots should be kept
+	// The S3 policy decides which snapshots are worth uploading
 	var retentionDecisions map[string]bool
 	if s.Unified {
-		retentionDecisions = retentionManager.GetUnifiedRetentionStatus(localSnapshots, s3Snapshots)
+		retentionDecisions = retentionManager.GetUnifiedRetentionStatus(localSnapshots, s3Snapshots, true).Remote
 	} else {
-		retentionDecisions = retentionManager.GetRetentionStatus(localSnapshots)
+		retentionDecisions = retentionManager.GetRemoteRetentionStatus(localSnapshots)
 	}
 
 	// Find local snapshots that should be kept but are missing from S3
@@ -217,7 +302,85 @@ func (s *SnapshotCmd) uploadMissingSnapshots(ctx *CLIContext) error {
 		}
 
 		log.Infof(PKG_CMD, "Successfully uploaded: s3://%s/%s", ctx.Config.S3.Bucket, s3Key)
+
+		// Upload the manifest too, when one was recorded
+		manifestPath := manifest.Name(snapshot.Path)
+		if _, err := os.Stat(manifestPath); err == nil {
+			if err := s3Client.Upload(context.Background(), manifestPath, manifest.Name(s3Key)); err != nil {
+				log.Warnf(PKG_CMD, "Failed to upload manifest for snapshot %s to S3: %v", snapshot.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeManifest records metadata about the snapshot file
+func (s *SnapshotCmd) writeManifest(manifestPath, snapshotPath string, source *etcd.EndpointStatus, status *etcd.SnapshotStatus, health *etcd.HealthReport, writeRate float64) error {
+	info, err := os.Stat(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat snapshot: %w", err)
+	}
+
+	digest, err := manifest.FileSHA256(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash snapshot: %w", err)
 	}
 
+	compressionAlgorithm := compression.GetCompressionAlgorithmFromExt(snapshotPath)
+	m := &manifest.Manifest{
+		Snapshot:    filepath.Base(snapshotPath),
+		CreatedAt:   time.Now().UTC(),
+		Endpoint:    source.Endpoint,
+		ClusterID:   source.ClusterID,
+		MemberID:    source.MemberID,
+		Revision:    status.Revision,
+		TotalKeys:   status.TotalKey,
+		DBHash:      status.Hash,
+		RaftIndex:   source.RaftIndex,
+		DBSize:      status.TotalSize,
+		Size:        info.Size(),
+		SHA256:      digest,
+		Compression: compressionAlgorithm,
+		Health:      health,
+		WriteRate:   writeRate,
+	}
+
+	if err := m.Save(manifestPath); err != nil {
+		return err
+	}
+
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_CMD).Str("file", manifestPath).Msg("Snapshot manifest saved")
 	return nil
 }
+
+// writeRate estimates the revisions per second of the cluster, from the newest local
+// manifest of the same cluster when there is one, otherwise from the revisions written
+// while the snapshot was taken. Returns 0 when it cannot be measured.
+func (s *SnapshotCmd) writeRate(ctx *CLIContext, etcdClient *etcd.Client, clusterID uint64, revision int64, started time.Time) float64 {
+	now := time.Now()
+
+	paths, _ := filepath.Glob(filepath.Join(ctx.Config.Etcd.SnapshotDir, "*"+manifest.Suffix))
+	var previous *manifest.Manifest
+	for _, path := range paths {
+		m, err := manifest.Load(path)
+		if err != nil || m.ClusterID != clusterID || m.Revision > revision || !m.CreatedAt.Before(started) {
+			continue
+		}
+		if previous == nil || m.CreatedAt.After(previous.CreatedAt) {
+			previous = m
+		}
+	}
+	if previous != nil {
+		return float64(revision-previous.Revision) / now.Sub(previous.CreatedAt).Seconds()
+	}
+
+	revisionCtx, cancel := context.WithTimeout(context.Background(), ctx.Config.Etcd.SnapshotTimeout)
+	defer cancel()
+	current, err := etcdClient.Revision(revisionCtx)
+	if err != nil {
+		log.Debugf(PKG_CMD, "Cannot measure write rate: %v", err)
+		return 0
+	}
+	return float64(current-revision) / now.Sub(started).Seconds()
+}
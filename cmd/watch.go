@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	"github.com/thedataflows/etcd2s3/pkg/manifest"
+	"github.com/thedataflows/etcd2s3/pkg/segment"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// WatchCmd streams changes between full snapshots into segments for point-in-time recovery
+type WatchCmd struct {
+	FromRevision     int64         `kong:"help='Revision to start watching from (default: resume after the last segment or the latest snapshot)'"`
+	SegmentInterval  time.Duration `kong:"help='Maximum time a segment stays open before it is stored',default='5m'"`
+	SegmentMaxEvents int           `kong:"help='Number of events after which a segment is stored',default='10000'"`
+	Compression      string        `kong:"help='Compression algorithm for segments',default='zstd',enum='none,bzip2,gzip,lz4,zstd'"`
+	UploadToS3       bool          `kong:"help='Upload segments to S3',default=true,name='upload-to-s3'"`
+	RemoveLocal      bool          `kong:"help='Remove local segments after S3 upload'"`
+	Duration         time.Duration `kong:"help='Stop after this long (default: run until interrupted)'"`
+}
+
+// segmentWriter accumulates watch events and stores them as segments
+type segmentWriter struct {
+	cmd      *WatchCmd
+	ctx      *CLIContext
+	start    int64
+	revision int64
+	opened   time.Time
+	events   []etcd.WatchEvent
+}
+
+func (w *WatchCmd) Run(ctx *CLIContext) error {
+	ctx, err := ctx.SingleCluster()
+	if err != nil {
+		return err
+	}
+	if w.SegmentInterval <= 0 {
+		return fmt.Errorf("--segment-interval must be positive")
+	}
+
+	etcdClient, err := etcd.NewClient(ctx.Config.Etcd)
+	if err != nil {
+		return fmt.Errorf("failed to create etcd client: %w", err)
+	}
+	defer etcdClient.Close()
+
+	fromRevision := w.FromRevision
+	if fromRevision <= 0 {
+		last, err := w.lastStoredRevision(ctx)
+		if err != nil {
+			return err
+		}
+		if last == 0 {
+			return fmt.Errorf("no snapshot or segment found to resume from, take a snapshot first or set --from-revision")
+		}
+		fromRevision = last + 1
+	}
+
+	if err := os.MkdirAll(ctx.Config.Etcd.SnapshotDir, 0755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	watchCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if w.Duration > 0 {
+		var cancel context.CancelFunc
+		watchCtx, cancel = context.WithTimeout(watchCtx, w.Duration)
+		defer cancel()
+	}
+
+	log.Infof(PKG_CMD, "Watching for changes from revision %d", fromRevision)
+
+	writer := &segmentWriter{cmd: w, ctx: ctx, start: fromRevision, revision: fromRevision - 1}
+	tick := min(w.SegmentInterval, 10*time.Second)
+	err = etcdClient.Watch(watchCtx, fromRevision, tick, writer.add)
+
+	// Store what was collected before stopping, also when the watch failed
+	if flushErr := writer.flush(); flushErr != nil {
+		return errors.Join(err, flushErr)
+	}
+	if errors.Is(err, etcd.ErrWatchCompacted) {
+		return fmt.Errorf("%w, take a new snapshot and restart the watch", err)
+	}
+	if err != nil && watchCtx.Err() == nil {
+		return err
+	}
+
+	log.Infof(PKG_CMD, "Watch stopped at revision %d", writer.revision)
+	return nil
+}
+
+// lastStoredRevision returns the highest revision covered by a local or S3 segment or snapshot manifest
+func (w *WatchCmd) lastStoredRevision(ctx *CLIContext) (int64, error) {
+	var last int64
+
+	entries, err := os.ReadDir(ctx.Config.Etcd.SnapshotDir)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+	for _, entry := range entries {
+		if _, end, ok := segment.Parse(entry.Name()); ok {
+			last = max(last, end)
+		} else if manifest.IsManifest(entry.Name()) {
+			m, err := manifest.Load(filepath.Join(ctx.Config.Etcd.SnapshotDir, entry.Name()))
+			if err != nil {
+				log.Warnf(PKG_CMD, "Skipping unreadable manifest %s: %v", entry.Name(), err)
+				continue
+			}
+			last = max(last, m.Revision)
+		}
+	}
+
+	if !w.UploadToS3 {
+		return last, nil
+	}
+
+	s3Client, err := ctx.GetS3Client()
+	if err != nil {
+		return 0, err
+	}
+	objects, err := s3Client.List(context.Background(), "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list S3 objects: %w", err)
+	}
+
+	// Every manifest is read: upload times say nothing about revisions, an old snapshot
+	// uploaded late is the most recently modified object
+	for _, object := range objects {
+		if _, end, ok := segment.Parse(object.Key); ok {
+			last = max(last, end)
+			continue
+		}
+		if !manifest.IsManifest(object.Key) {
+			continue
+		}
+		data, err := s3Client.ReadObject(context.Background(), object.Key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read manifest %s: %w", object.Key, err)
+		}
+		m, err := manifest.Parse(data)
+		if err != nil {
+			log.Warnf(PKG_CMD, "Skipping unreadable manifest %s: %v", object.Key, err)
+			continue
+		}
+		last = max(last, m.Revision)
+	}
+
+	return last, nil
+}
+
+// add collects events and stores a segment once it is full or has been open long enough
+func (s *segmentWriter) add(events []etcd.WatchEvent, revision int64) error {
+	// The segment interval counts from the first change it holds
+	if len(s.events) == 0 && len(events) > 0 {
+		s.opened = time.Now()
+	}
+	s.events = append(s.events, events...)
+	s.revision = revision
+
+	if len(s.events) >= s.cmd.SegmentMaxEvents || (len(s.events) > 0 && time.Since(s.opened) >= s.cmd.SegmentInterval) {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush stores the collected events as a segment and starts the next one
+func (s *segmentWriter) flush() error {
+	if len(s.events) == 0 {
+		return nil
+	}
+
+	segmentPath := filepath.Join(s.ctx.Config.Etcd.SnapshotDir, segment.Name(s.start, s.revision))
+	if err := segment.Write(segmentPath, s.events); err != nil {
+		return err
+	}
+
+	finalPath, err := compressArtifact(segmentPath, s.cmd.Compression)
+	if err != nil {
+		return fmt.Errorf("failed to compress segment: %w", err)
+	}
+
+	log.Logger.Info().Str(log.KEY_PKG, PKG_CMD).Str("file", finalPath).Int64("start_revision", s.start).Int64("end_revision", s.revision).Int("events", len(s.events)).Msg("Segment saved")
+
+	if s.cmd.UploadToS3 {
+		s3Client, err := s.ctx.GetS3Client()
+		if err != nil {
+			return err
+		}
+
+		s3Key := filepath.Base(finalPath)
+		if err := s3Client.Upload(context.Background(), finalPath, s3Key); err != nil {
+			return fmt.Errorf("failed to upload segment to S3: %w", err)
+		}
+		log.Debugf(PKG_CMD, "Segment uploaded to S3: s3://%s/%s", s.ctx.Config.S3.Bucket, s3Key)
+
+		if s.cmd.RemoveLocal || s.ctx.Config.Policy.RemoveLocal {
+			if err := os.Remove(finalPath); err != nil {
+				log.Warnf(PKG_CMD, "Failed to remove local segment %s: %v", finalPath, err)
+			}
+		}
+	}
+
+	s.start = s.revision + 1
+	s.events = nil
+	return nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	_ "time/tzdata" // retention time zones, the container image has no zoneinfo
 
 	"github.com/thedataflows/etcd2s3/cmd"
 	log "github.com/thedataflows/go-lib-log"
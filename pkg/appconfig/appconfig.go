@@ -1,19 +1,39 @@
 package appconfig
 
 import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"time"
+
+	"github.com/goccy/go-yaml"
 )
 
 // EtcdConfig holds etcd-related configuration
 type EtcdConfig struct {
-	Endpoints       []string      `kong:"help='etcd endpoints',default='http://localhost:2379'"`
-	SnapshotDir     string        `kong:"help='Directory to store local snapshots',default='/var/lib/etcd/snapshots'"`
-	SnapshotTimeout time.Duration `kong:"help='Timeout for snapshot operations',default='1m0s'"`
-	Username        string        `kong:"help='etcd username for authentication'"`
-	Password        string        `kong:"help='etcd password for authentication'"`
-	CertFile        string        `kong:"help='etcd client certificate file'"`
-	KeyFile         string        `kong:"help='etcd client key file'"`
-	CaFile          string        `kong:"help='etcd CA certificate file'"`
+	Endpoints          []string      `kong:"help='etcd endpoints',default='http://localhost:2379'" yaml:"endpoints"`
+	SnapshotDir        string        `kong:"help='Directory to store local snapshots',default='/var/lib/etcd/snapshots'" yaml:"snapshot-dir"`
+	SnapshotNameLayout string        `kong:"help='Go time layout at the start of snapshot file names, in UTC, dates snapshots by name instead of modification time (empty disables)',default='etcd-snapshot-20060102-150405Z'" yaml:"snapshot-name-layout"`
+	DialTimeout        time.Duration `kong:"help='Timeout for establishing a connection to etcd',default='5s'" yaml:"dial-timeout"`
+	KeepAliveTime      time.Duration `kong:"help='Interval of client keepalive pings (0 disables)',default='30s'" yaml:"keep-alive-time"`
+	KeepAliveTimeout   time.Duration `kong:"help='Time to wait for a keepalive response before closing the connection',default='10s'" yaml:"keep-alive-timeout"`
+	RequestTimeout     time.Duration `kong:"help='Timeout for individual etcd requests (status, health, alarms)',default='5s'" yaml:"request-timeout"`
+	MaxRecvMsgSize     int           `kong:"help='Maximum gRPC message size the client can receive in bytes (0 uses the client default)'" yaml:"max-recv-msg-size"`
+	SnapshotTimeout    time.Duration `kong:"help='Timeout for snapshot operations',default='1m0s'" yaml:"snapshot-timeout"`
+	SnapshotSource     string        `kong:"help='Snapshot source endpoint selection (first,follower,leader,smallest-db,latest-index)',default='follower',enum='first,follower,leader,smallest-db,latest-index'" yaml:"snapshot-source"`
+	CompactTimeout     time.Duration `kong:"help='Timeout for compaction before a snapshot',default='1m0s'" yaml:"compact-timeout"`
+	DefragTimeout      time.Duration `kong:"help='Timeout for defragmentation before a snapshot',default='5m0s'" yaml:"defrag-timeout"`
+	Username           string        `kong:"help='etcd username for authentication'" yaml:"username"`
+	Password           string        `kong:"help='etcd password for authentication'" yaml:"password"`
+	CertFile           string        `kong:"help='etcd client certificate file'" yaml:"cert-file"`
+	KeyFile            string        `kong:"help='etcd client key file'" yaml:"key-file"`
+	CaFile             string        `kong:"help='etcd CA certificate file (system root CAs are used when not set)'" yaml:"ca-file"`
+	InsecureSkipVerify bool          `kong:"help='Skip etcd server certificate verification (insecure)'" yaml:"insecure-skip-verify"`
+	ServerName         string        `kong:"help='Server name used to verify the etcd server certificate'" yaml:"server-name"`
+	TLSMinVersion      string        `kong:"help='Minimum TLS version (1.2,1.3)',default='1.2',enum='1.2,1.3',name='tls-min-version'" yaml:"tls-min-version"`
+	TLSCipherSuites    []string      `kong:"help='Allowed TLS 1.2 cipher suites (Go names, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)',name='tls-cipher-suites'" yaml:"tls-cipher-suites"`
 }
 
 // S3Config holds S3-related configuration
@@ -29,19 +49,262 @@ type S3Config struct {
 
 // RetentionPolicy holds retention policy configuration
 type RetentionPolicy struct {
-	KeepLast       int           `kong:"help='Keep last N snapshots',default=5"`
-	KeepLastDays   int           `kong:"help='Keep snapshots for the last N days',default=7"`
-	KeepLastHours  int           `kong:"help='Keep snapshots for the last N hours',default=24"`
-	KeepLastWeeks  int           `kong:"help='Keep snapshots for the last N weeks',default=4"`
-	KeepLastMonths int           `kong:"help='Keep snapshots for the last N months',default=3"`
-	KeepLastYears  int           `kong:"help='Keep snapshots for the last N years',default=1"`
-	RemoveLocal    bool          `kong:"help='Remove local snapshots after upload to S3'"`
-	Timeout        time.Duration `kong:"help='Timeout for retention operations',default='5m'"`
+	Mode           string        `kong:"help='Retention mode: gfs keeps the newest snapshot of each of the last N hours, days, weeks, months and years, age keeps snapshots younger than every window',enum='gfs,age',default='gfs'" yaml:"mode"`
+	KeepLast       int           `kong:"help='Keep last N snapshots',default=5" yaml:"keep-last"`
+	KeepLastDays   int           `kong:"help='Keep snapshots for the last N days',default=7" yaml:"keep-last-days"`
+	KeepLastHours  int           `kong:"help='Keep snapshots for the last N hours',default=24" yaml:"keep-last-hours"`
+	KeepLastWeeks  int           `kong:"help='Keep snapshots for the last N weeks',default=4" yaml:"keep-last-weeks"`
+	KeepLastMonths int           `kong:"help='Keep snapshots for the last N months',default=3" yaml:"keep-last-months"`
+	KeepLastYears  int           `kong:"help='Keep snapshots for the last N years',default=1" yaml:"keep-last-years"`
+	TimeZone       string        `kong:"help='Time zone of retention periods, an IANA name such as Europe/Berlin, or Local',default='Local'" yaml:"time-zone"`
+	MaxCount       int           `kong:"help='Keep at most N snapshots, the oldest beyond keep-last are deleted first (0 is unlimited)'" yaml:"max-count"`
+	MaxTotalBytes  int64         `kong:"help='Keep at most this many bytes of snapshots, the oldest beyond keep-last are deleted first (0 is unlimited)'" yaml:"max-total-bytes"`
+	RemoveLocal    bool          `kong:"help='Remove local snapshots after upload to S3'" yaml:"remove-local"`
+	Timeout        time.Duration `kong:"help='Timeout for retention operations',default='5m'" yaml:"timeout"`
+}
+
+// Location returns the time zone retention periods are evaluated in
+func (p RetentionPolicy) Location() (*time.Location, error) {
+	if p.TimeZone == "" || p.TimeZone == "Local" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retention time zone %q: %w", p.TimeZone, err)
+	}
+	return loc, nil
+}
+
+// PolicyOverride overrides the retention policy for one storage tier. Unset fields
+// inherit the shared policy.
+type PolicyOverride struct {
+	Mode           *string `kong:"help='Retention mode (gfs,age), default is the shared policy'" yaml:"mode"`
+	KeepLast       *int    `kong:"help='Keep last N snapshots, default is the shared policy'" yaml:"keep-last"`
+	KeepLastDays   *int    `kong:"help='Keep snapshots for the last N days, default is the shared policy'" yaml:"keep-last-days"`
+	KeepLastHours  *int    `kong:"help='Keep snapshots for the last N hours, default is the shared policy'" yaml:"keep-last-hours"`
+	KeepLastWeeks  *int    `kong:"help='Keep snapshots for the last N weeks, default is the shared policy'" yaml:"keep-last-weeks"`
+	KeepLastMonths *int    `kong:"help='Keep snapshots for the last N months, default is the shared policy'" yaml:"keep-last-months"`
+	KeepLastYears  *int    `kong:"help='Keep snapshots for the last N years, default is the shared policy'" yaml:"keep-last-years"`
+	MaxCount       *int    `kong:"help='Keep at most N snapshots, default is the shared policy'" yaml:"max-count"`
+	MaxTotalBytes  *int64  `kong:"help='Keep at most this many bytes of snapshots, default is the shared policy'" yaml:"max-total-bytes"`
+}
+
+// Apply returns policy with the fields set in the override replaced
+func (o PolicyOverride) Apply(policy RetentionPolicy) RetentionPolicy {
+	if o.Mode != nil {
+		policy.Mode = *o.Mode
+	}
+	for _, field := range []struct {
+		override *int
+		value    *int
+	}{
+		{o.KeepLast, &policy.KeepLast},
+		{o.KeepLastDays, &policy.KeepLastDays},
+		{o.KeepLastHours, &policy.KeepLastHours},
+		{o.KeepLastWeeks, &policy.KeepLastWeeks},
+		{o.KeepLastMonths, &policy.KeepLastMonths},
+		{o.KeepLastYears, &policy.KeepLastYears},
+		{o.MaxCount, &policy.MaxCount},
+	} {
+		if field.override != nil {
+			*field.value = *field.override
+		}
+	}
+	if o.MaxTotalBytes != nil {
+		policy.MaxTotalBytes = *o.MaxTotalBytes
+	}
+	return policy
+}
+
+// clone returns a copy that does not share values with o, so decoding a cluster on top
+// of it leaves the inherited override untouched
+func (o PolicyOverride) clone() PolicyOverride {
+	copyOf := func(v *int) *int {
+		if v == nil {
+			return nil
+		}
+		c := *v
+		return &c
+	}
+	clone := PolicyOverride{
+		KeepLast:       copyOf(o.KeepLast),
+		KeepLastDays:   copyOf(o.KeepLastDays),
+		KeepLastHours:  copyOf(o.KeepLastHours),
+		KeepLastWeeks:  copyOf(o.KeepLastWeeks),
+		KeepLastMonths: copyOf(o.KeepLastMonths),
+		KeepLastYears:  copyOf(o.KeepLastYears),
+		MaxCount:       copyOf(o.MaxCount),
+	}
+	if o.Mode != nil {
+		mode := *o.Mode
+		clone.Mode = &mode
+	}
+	if o.MaxTotalBytes != nil {
+		maxTotalBytes := *o.MaxTotalBytes
+		clone.MaxTotalBytes = &maxTotalBytes
+	}
+	return clone
+}
+
+// ClusterConfig describes a named etcd cluster.
+// Settings not given in the clusters file are inherited from the top-level configuration.
+type ClusterConfig struct {
+	Name         string          `yaml:"name"`
+	Etcd         EtcdConfig      `yaml:"etcd"`
+	KeyPrefix    string          `yaml:"key-prefix"`
+	Policy       RetentionPolicy `yaml:"policy"`
+	LocalPolicy  PolicyOverride  `yaml:"local-policy"`
+	RemotePolicy PolicyOverride  `yaml:"remote-policy"`
 }
 
 // AppConfig is the top-level configuration structure for the application.
 type AppConfig struct {
-	Etcd   EtcdConfig      `kong:"embed,prefix='etcd-',group='ETCD'"`
-	S3     S3Config        `kong:"embed,prefix='aws-',group='S3'"`
-	Policy RetentionPolicy `kong:"embed,prefix='policy-',group='Retention Policy'"`
+	ClustersFile string          `kong:"help='YAML file listing named etcd clusters',type='path'"`
+	Cluster      []string        `kong:"help='Named clusters to operate on (default: all clusters in the clusters file)'"`
+	Etcd         EtcdConfig      `kong:"embed,prefix='etcd-',group='ETCD'"`
+	S3           S3Config        `kong:"embed,prefix='aws-',group='S3'"`
+	Policy       RetentionPolicy `kong:"embed,prefix='policy-',group='Retention Policy'"`
+	LocalPolicy  PolicyOverride  `kong:"embed,prefix='local-policy-',group='Local Retention Policy'"`
+	RemotePolicy PolicyOverride  `kong:"embed,prefix='remote-policy-',group='S3 Retention Policy'"`
+	Clusters     []ClusterConfig `kong:"-"`
+}
+
+// LoadClusters reads the clusters file, if configured, into Clusters.
+// Each cluster starts from the top-level etcd and policy settings; its snapshots are
+// kept in a per-cluster subdirectory of the snapshot dir and under a per-cluster S3 key prefix.
+func (c *AppConfig) LoadClusters() error {
+	if c.ClustersFile == "" {
+		if len(c.Cluster) > 0 {
+			return fmt.Errorf("--cluster requires a clusters file")
+		}
+		return nil
+	}
+
+	data, err := os.ReadFile(c.ClustersFile)
+	if err != nil {
+		return fmt.Errorf("failed to read clusters file: %w", err)
+	}
+
+	var file struct {
+		Clusters []map[string]any `yaml:"clusters"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse clusters file: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, raw := range file.Clusters {
+		// Decode each entry on top of the inherited settings
+		cluster := ClusterConfig{Etcd: c.Etcd, Policy: c.Policy, LocalPolicy: c.LocalPolicy.clone(), RemotePolicy: c.RemotePolicy.clone()}
+		node, err := yaml.Marshal(raw)
+		if err != nil {
+			return fmt.Errorf("failed to read cluster #%d: %w", i+1, err)
+		}
+		if err := yaml.Unmarshal(node, &cluster); err != nil {
+			return fmt.Errorf("failed to parse cluster #%d: %w", i+1, err)
+		}
+
+		if cluster.Name == "" {
+			return fmt.Errorf("cluster #%d has no name", i+1)
+		}
+		if seen[cluster.Name] {
+			return fmt.Errorf("duplicate cluster name: %s", cluster.Name)
+		}
+		seen[cluster.Name] = true
+
+		if cluster.KeyPrefix == "" {
+			cluster.KeyPrefix = cluster.Name
+		}
+		if cluster.Etcd.SnapshotDir == c.Etcd.SnapshotDir {
+			cluster.Etcd.SnapshotDir = filepath.Join(c.Etcd.SnapshotDir, cluster.Name)
+		}
+
+		c.Clusters = append(c.Clusters, cluster)
+	}
+
+	if len(c.Clusters) == 0 {
+		return fmt.Errorf("clusters file %s defines no clusters", c.ClustersFile)
+	}
+
+	for _, name := range c.Cluster {
+		if !seen[name] {
+			return fmt.Errorf("unknown cluster: %s", name)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the settings that cannot be checked while parsing flags, for the
+// top-level configuration and every loaded cluster
+func (c *AppConfig) Validate() error {
+	if err := validatePolicies(c.Policy, c.LocalPolicy, c.RemotePolicy); err != nil {
+		return err
+	}
+	for _, cluster := range c.Clusters {
+		if err := validatePolicies(cluster.Policy, cluster.LocalPolicy, cluster.RemotePolicy); err != nil {
+			return fmt.Errorf("cluster %s: %w", cluster.Name, err)
+		}
+	}
+	return nil
+}
+
+// validatePolicies checks the time zone of a policy and the modes of the policy and its
+// tier overrides, which the clusters file sets without the checks of the flag parser
+func validatePolicies(policy RetentionPolicy, local, remote PolicyOverride) error {
+	if _, err := policy.Location(); err != nil {
+		return err
+	}
+	for _, field := range []struct {
+		name string
+		mode *string
+	}{
+		{"policy", &policy.Mode},
+		{"local-policy", local.Mode},
+		{"remote-policy", remote.Mode},
+	} {
+		// An empty mode is the default
+		if field.mode != nil && !slices.Contains([]string{"", "gfs", "age"}, *field.mode) {
+			return fmt.Errorf("invalid %s mode %q, expected gfs or age", field.name, *field.mode)
+		}
+	}
+	return nil
+}
+
+// SelectedClusters returns the clusters chosen with --cluster, or all clusters
+func (c *AppConfig) SelectedClusters() []ClusterConfig {
+	if len(c.Cluster) == 0 {
+		return c.Clusters
+	}
+
+	var selected []ClusterConfig
+	for _, cluster := range c.Clusters {
+		if slices.Contains(c.Cluster, cluster.Name) {
+			selected = append(selected, cluster)
+		}
+	}
+	return selected
+}
+
+// ForCluster returns a copy of the configuration scoped to a single cluster
+func (c *AppConfig) ForCluster(cluster ClusterConfig) *AppConfig {
+	scoped := *c
+	scoped.Etcd = cluster.Etcd
+	scoped.Policy = cluster.Policy
+	scoped.LocalPolicy = cluster.LocalPolicy
+	scoped.RemotePolicy = cluster.RemotePolicy
+	scoped.S3.Prefix = path.Join(c.S3.Prefix, cluster.KeyPrefix)
+	scoped.Cluster = []string{cluster.Name}
+	scoped.Clusters = nil
+	return &scoped
+}
+
+// LocalRetention returns the retention policy of local snapshots
+func (c *AppConfig) LocalRetention() RetentionPolicy {
+	return c.LocalPolicy.Apply(c.Policy)
+}
+
+// RemoteRetention returns the retention policy of S3 snapshots
+func (c *AppConfig) RemoteRetention() RetentionPolicy {
+	return c.RemotePolicy.Apply(c.Policy)
 }
@@ -0,0 +1,149 @@
+package appconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testClustersFile = `clusters:
+  - name: prod-eu
+    etcd:
+      endpoints:
+        - https://etcd-eu-1:2379
+        - https://etcd-eu-2:2379
+      dial-timeout: 30s
+    policy:
+      keep-last: 10
+    remote-policy:
+      keep-last-days: 90
+      max-total-bytes: 1073741824
+    local-policy:
+      keep-last: 2
+  - name: prod-us
+    key-prefix: us/prod
+    etcd:
+      endpoints:
+        - https://etcd-us-1:2379
+      snapshot-dir: /backups/us
+`
+
+func TestLoadClusters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clusters.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testClustersFile), 0644))
+
+	cfg := AppConfig{
+		ClustersFile: path,
+		Etcd: EtcdConfig{
+			Endpoints:   []string{"http://localhost:2379"},
+			SnapshotDir: "/var/lib/etcd/snapshots",
+			DialTimeout: 5 * time.Second,
+			Username:    "backup",
+		},
+		S3:          S3Config{Prefix: "etcd"},
+		Policy:      RetentionPolicy{KeepLast: 5, KeepLastDays: 7},
+		LocalPolicy: PolicyOverride{KeepLast: intPtr(3)},
+	}
+	require.NoError(t, cfg.LoadClusters())
+	require.Len(t, cfg.Clusters, 2)
+
+	eu := cfg.Clusters[0]
+	assert.Equal(t, "prod-eu", eu.Name)
+	assert.Equal(t, "prod-eu", eu.KeyPrefix)
+	assert.Equal(t, []string{"https://etcd-eu-1:2379", "https://etcd-eu-2:2379"}, eu.Etcd.Endpoints)
+	assert.Equal(t, 30*time.Second, eu.Etcd.DialTimeout)
+	assert.Equal(t, "backup", eu.Etcd.Username, "unset fields are inherited")
+	assert.Equal(t, filepath.Join("/var/lib/etcd/snapshots", "prod-eu"), eu.Etcd.SnapshotDir)
+	assert.Equal(t, 10, eu.Policy.KeepLast)
+	assert.Equal(t, 7, eu.Policy.KeepLastDays)
+
+	us := cfg.Clusters[1]
+	assert.Equal(t, "us/prod", us.KeyPrefix)
+	assert.Equal(t, "/backups/us", us.Etcd.SnapshotDir)
+	assert.Equal(t, 5, us.Policy.KeepLast)
+
+	// Tier overrides apply on top of the cluster policy and are inherited field by field
+	euScoped := cfg.ForCluster(eu)
+	assert.Equal(t, RetentionPolicy{KeepLast: 2, KeepLastDays: 7}, euScoped.LocalRetention())
+	assert.Equal(t, RetentionPolicy{KeepLast: 10, KeepLastDays: 90, MaxTotalBytes: 1 << 30}, euScoped.RemoteRetention())
+	usScoped := cfg.ForCluster(us)
+	assert.Equal(t, RetentionPolicy{KeepLast: 3, KeepLastDays: 7}, usScoped.LocalRetention())
+	assert.Equal(t, us.Policy, usScoped.RemoteRetention())
+	assert.Equal(t, 3, *cfg.LocalPolicy.KeepLast, "decoding a cluster leaves the inherited override alone")
+
+	scoped := cfg.ForCluster(us)
+	assert.Equal(t, "etcd/us/prod", scoped.S3.Prefix)
+	assert.Equal(t, us.Etcd, scoped.Etcd)
+	assert.Empty(t, scoped.Clusters)
+
+	assert.Len(t, cfg.SelectedClusters(), 2)
+	cfg.Cluster = []string{"prod-us"}
+	selected := cfg.SelectedClusters()
+	require.Len(t, selected, 1)
+	assert.Equal(t, "prod-us", selected[0].Name)
+}
+
+func TestLoadClusters_Errors(tMain *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		cluster  []string
+		expected string
+	}{
+		{name: "missing name", content: "clusters:\n  - key-prefix: x\n", expected: "has no name"},
+		{name: "duplicate name", content: "clusters:\n  - name: a\n  - name: a\n", expected: "duplicate cluster name"},
+		{name: "no clusters", content: "clusters: []\n", expected: "defines no clusters"},
+		{name: "unknown cluster", content: "clusters:\n  - name: a\n", cluster: []string{"b"}, expected: "unknown cluster"},
+	}
+
+	for _, tt := range tests {
+		tMain.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "clusters.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+
+			cfg := AppConfig{ClustersFile: path, Cluster: tt.cluster}
+			assert.ErrorContains(t, cfg.LoadClusters(), tt.expected)
+		})
+	}
+
+	cfg := AppConfig{Cluster: []string{"a"}}
+	assert.ErrorContains(tMain, cfg.LoadClusters(), "requires a clusters file")
+}
+
+func TestValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clusters.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("clusters:\n  - name: a\n  - name: b\n    policy:\n      time-zone: Mars/Olympus\n"), 0644))
+
+	cfg := AppConfig{ClustersFile: path, Policy: RetentionPolicy{TimeZone: "UTC"}}
+	require.NoError(t, cfg.LoadClusters())
+	assert.ErrorContains(t, cfg.Validate(), "cluster b: invalid retention time zone")
+
+	require.NoError(t, os.WriteFile(path, []byte("clusters:\n  - name: a\n    remote-policy:\n      mode: agee\n"), 0644))
+	cfg = AppConfig{ClustersFile: path}
+	require.NoError(t, cfg.LoadClusters())
+	assert.ErrorContains(t, cfg.Validate(), `cluster a: invalid remote-policy mode "agee"`)
+
+	require.NoError(t, os.WriteFile(path, []byte("clusters:\n  - name: a\n    policy:\n      mode: GFS\n"), 0644))
+	cfg = AppConfig{ClustersFile: path}
+	require.NoError(t, cfg.LoadClusters())
+	assert.ErrorContains(t, cfg.Validate(), `cluster a: invalid policy mode "GFS"`)
+
+	mode := "agee"
+	cfg = AppConfig{LocalPolicy: PolicyOverride{Mode: &mode}}
+	assert.ErrorContains(t, cfg.Validate(), `invalid local-policy mode "agee"`)
+
+	mode = "age"
+	cfg = AppConfig{Policy: RetentionPolicy{TimeZone: "Local"}, LocalPolicy: PolicyOverride{Mode: &mode}}
+	require.NoError(t, cfg.Validate())
+	loc, err := cfg.Policy.Location()
+	require.NoError(t, err)
+	assert.Equal(t, time.Local, loc)
+}
+
+func intPtr(v int) *int {
+	return &v
+}
@@ -0,0 +1,140 @@
+// Package datadir checks etcd data directories before a restore and moves existing
+// data out of the way.
+package datadir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.etcd.io/etcd/client/pkg/v3/fileutil"
+)
+
+// WALReserve is the space reserved for the WAL of a restored member on top of the
+// snapshot size, WAL segments are preallocated at 64 MiB.
+const WALReserve = 64 * 1024 * 1024
+
+// State describes a data directory before a restore
+type State struct {
+	Path string
+	// Exists reports whether the directory exists
+	Exists bool
+	// Empty reports whether the directory has no entries, true when it does not exist
+	Empty bool
+	// LockedBy is the file held locked by a running etcd process, empty when none is
+	LockedBy string
+	// FreeBytes is the free space of the file system the directory is (or will be) on
+	FreeBytes uint64
+}
+
+// Inspect reports the state of a data directory
+func Inspect(dir string) (*State, error) {
+	state := &State{Path: dir, Empty: true}
+
+	entries, err := os.ReadDir(dir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read data directory %s: %w", dir, err)
+	default:
+		state.Exists = true
+		state.Empty = len(entries) == 0
+	}
+
+	if state.Exists {
+		state.LockedBy, err = lockedFile(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	state.FreeBytes, err = freeSpace(existingAncestor(dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get free space for %s: %w", dir, err)
+	}
+	return state, nil
+}
+
+// BackupPath returns the path an existing data directory is moved to
+func BackupPath(dir string, now time.Time) string {
+	return fmt.Sprintf("%s.backup-%s", filepath.Clean(dir), now.Format("20060102-150405"))
+}
+
+// Backup moves a data directory to the backup path
+func Backup(dir, backup string) error {
+	if _, err := os.Stat(backup); err == nil {
+		return fmt.Errorf("backup %s already exists", backup)
+	}
+	if err := os.Rename(dir, backup); err != nil {
+		return fmt.Errorf("failed to move %s to %s (a mount point cannot be moved, back it up manually): %w", dir, backup, err)
+	}
+	return nil
+}
+
+// SetOwner changes the owner of dir and everything in it to uid and gid, and the mode of
+// every directory in it to dirMode. A uid or gid of -1 keeps it unchanged, a dirMode of
+// 0 keeps the directory modes. Ownership cannot be changed on Windows.
+func SetOwner(dir string, uid, gid int, dirMode os.FileMode) error {
+	return filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if uid >= 0 || gid >= 0 {
+			if err := os.Lchown(path, uid, gid); err != nil {
+				return fmt.Errorf("failed to change owner of %s: %w", path, err)
+			}
+		}
+		if dirMode != 0 && entry.IsDir() {
+			if err := os.Chmod(path, dirMode); err != nil {
+				return fmt.Errorf("failed to change mode of %s: %w", path, err)
+			}
+		}
+		return nil
+	})
+}
+
+// lockedFile returns the first WAL or backend file of the directory held locked by
+// another process. etcd locks its WAL files for as long as it runs. WAL files directly in
+// dir are checked too, for directories passed to etcd as --wal-dir.
+func lockedFile(dir string) (string, error) {
+	var candidates []string
+	for _, pattern := range []string{filepath.Join(dir, "member", "wal", "*.wal"), filepath.Join(dir, "*.wal")} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", err
+		}
+		candidates = append(candidates, matches...)
+	}
+	candidates = append(candidates, filepath.Join(dir, "member", "snap", "db"))
+
+	for _, path := range candidates {
+		f, err := fileutil.TryLockFile(path, os.O_RDWR, fileutil.PrivateFileMode)
+		switch {
+		case errors.Is(err, fileutil.ErrLocked):
+			return path, nil
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return "", fmt.Errorf("failed to check lock on %s: %w", path, err)
+		default:
+			_ = f.Close()
+		}
+	}
+	return "", nil
+}
+
+// existingAncestor returns the closest directory of path that exists
+func existingAncestor(path string) string {
+	path = filepath.Clean(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,79 @@
+package datadir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+)
+
+func TestInspect(tMain *testing.T) {
+	tMain.Run("missing", func(t *testing.T) {
+		state, err := Inspect(filepath.Join(t.TempDir(), "missing", "etcd"))
+		require.NoError(t, err)
+		assert.False(t, state.Exists)
+		assert.True(t, state.Empty)
+		assert.Positive(t, state.FreeBytes, "measured on the closest existing parent")
+	})
+
+	tMain.Run("empty", func(t *testing.T) {
+		state, err := Inspect(t.TempDir())
+		require.NoError(t, err)
+		assert.True(t, state.Exists)
+		assert.True(t, state.Empty)
+		assert.Empty(t, state.LockedBy)
+	})
+
+	tMain.Run("in use by etcd", func(t *testing.T) {
+		srv := etcdtest.Start(t, etcdtest.Config{})
+
+		state, err := Inspect(srv.DataDir)
+		require.NoError(t, err)
+		assert.False(t, state.Empty)
+		assert.NotEmpty(t, state.LockedBy)
+
+		srv.Stop()
+		state, err = Inspect(srv.DataDir)
+		require.NoError(t, err)
+		assert.False(t, state.Empty)
+		assert.Empty(t, state.LockedBy)
+	})
+}
+
+func TestBackup(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "etcd")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "member"), 0700))
+
+	backup := BackupPath(dir+"/", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	assert.Equal(t, dir+".backup-20240102-030405", backup)
+
+	require.NoError(t, Backup(dir, backup))
+	assert.NoDirExists(t, dir)
+	assert.DirExists(t, filepath.Join(backup, "member"))
+
+	// An existing backup is never overwritten
+	require.NoError(t, os.MkdirAll(dir, 0700))
+	assert.Error(t, Backup(dir, backup))
+}
+
+func TestSetOwner(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "member", "wal"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "member", "wal", "0.wal"), nil, 0600))
+
+	// Owning by the current user works without privileges
+	require.NoError(t, SetOwner(dir, os.Getuid(), os.Getgid(), 0700))
+
+	for _, path := range []string{dir, filepath.Join(dir, "member"), filepath.Join(dir, "member", "wal")} {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm(), path)
+	}
+	info, err := os.Stat(filepath.Join(dir, "member", "wal", "0.wal"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "file modes are kept")
+}
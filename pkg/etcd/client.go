@@ -2,14 +2,14 @@ package etcd
 
 import (
 	"context"
-	"crypto/tls"
-	"crypto/x509"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	"github.com/thedataflows/etcd2s3/pkg/datadir"
 	log "github.com/thedataflows/go-lib-log"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/snapshot"
@@ -19,10 +19,18 @@ import (
 
 const PKG_ETCD = "etcd"
 
+// Defaults applied when the configuration leaves timeouts unset
+const (
+	defaultDialTimeout    = 5 * time.Second
+	defaultRequestTimeout = 5 * time.Second
+)
+
 // Client wraps etcd client functionality
 type Client struct {
-	client *clientv3.Client
-	config clientv3.Config
+	client         *clientv3.Client
+	config         clientv3.Config
+	strategy       string
+	requestTimeout time.Duration
 }
 
 // RestoreOptions holds options for etcd restore
@@ -31,18 +39,46 @@ type RestoreOptions struct {
 	DataDir                  string
 	Name                     string
 	InitialCluster           string
-	InitialAdvertisePeerURLs string
+	InitialAdvertisePeerURLs []string
+	InitialClusterToken      string
 	SkipHashCheck            bool
+	// RevisionBump increases the revision after restore so watchers never see it go back.
+	// Requires MarkCompacted.
+	RevisionBump uint64
+	// MarkCompacted marks the bumped revision as compacted, so watches from older
+	// revisions fail instead of silently missing changes. Requires RevisionBump.
+	MarkCompacted bool
+	// Layout is the WAL directory and ownership of the restored member
+	Layout MemberLayout
 }
 
 // NewClient creates a new etcd client
 func NewClient(cfg appconfig.EtcdConfig) (*Client, error) {
 	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Strs("endpoints", cfg.Endpoints).Msg("Creating new etcd client")
 
+	dialTimeout := cfg.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	requestTimeout := cfg.RequestTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = defaultRequestTimeout
+	}
+
 	clientConfig := clientv3.Config{
-		Endpoints:   cfg.Endpoints,
-		DialTimeout: 5 * time.Second,
+		Endpoints:            cfg.Endpoints,
+		DialTimeout:          dialTimeout,
+		DialKeepAliveTime:    cfg.KeepAliveTime,
+		DialKeepAliveTimeout: cfg.KeepAliveTimeout,
+		MaxCallRecvMsgSize:   cfg.MaxRecvMsgSize,
 	}
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).
+		Str("dial_timeout", dialTimeout.String()).
+		Str("request_timeout", requestTimeout.String()).
+		Str("keepalive_time", cfg.KeepAliveTime.String()).
+		Str("keepalive_timeout", cfg.KeepAliveTimeout.String()).
+		Int("max_recv_msg_size", cfg.MaxRecvMsgSize).
+		Msg("Client timeouts")
 
 	// Set up authentication
 	if cfg.Username != "" {
@@ -52,47 +88,11 @@ func NewClient(cfg appconfig.EtcdConfig) (*Client, error) {
 	}
 
 	// Set up TLS
-	if cfg.CertFile != "" && cfg.KeyFile != "" || cfg.CaFile != "" {
-		log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("Setting up TLS configuration")
-		tlsConfig := &tls.Config{}
-
-		// Load client certificate if both cert and key files are provided
-		if cfg.CertFile != "" && cfg.KeyFile != "" {
-			log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Str("cert_file", cfg.CertFile).Str("key_file", cfg.KeyFile).Msg("Loading client certificate")
-			cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
-			if err != nil {
-				return nil, fmt.Errorf("failed to load client certificate: %w", err)
-			}
-			tlsConfig.Certificates = []tls.Certificate{cert}
-			log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("Client certificate loaded successfully")
-		}
-
-		if cfg.CaFile != "" {
-			log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Str("ca_file", cfg.CaFile).Msg("Loading CA certificate")
-			// Load CA certificate if provided
-			caCert, err := os.ReadFile(cfg.CaFile)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read CA certificate file: %w", err)
-			}
-
-			caCertPool := x509.NewCertPool()
-			if !caCertPool.AppendCertsFromPEM(caCert) {
-				return nil, fmt.Errorf("failed to parse CA certificate")
-			}
-
-			tlsConfig.RootCAs = caCertPool
-			tlsConfig.InsecureSkipVerify = false
-			log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("CA certificate loaded, TLS verification enabled")
-		} else {
-			// If no CA file is provided but we're using TLS, skip verification
-			tlsConfig.InsecureSkipVerify = true
-			log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("No CA certificate provided, TLS verification disabled")
-		}
-
-		clientConfig.TLS = tlsConfig
-	} else {
-		log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("No TLS configuration provided")
+	tlsConfig, err := buildTLSConfig(cfg)
+	if err != nil {
+		return nil, err
 	}
+	clientConfig.TLS = tlsConfig
 
 	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("Attempting to connect to etcd")
 	client, err := clientv3.New(clientConfig)
@@ -103,20 +103,29 @@ func NewClient(cfg appconfig.EtcdConfig) (*Client, error) {
 
 	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("etcd client created successfully")
 
-	// Test the connection with a quick status check
-	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("Testing connection with status check")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	c := &Client{client: client, config: clientConfig, strategy: cfg.SnapshotSource, requestTimeout: requestTimeout}
 
-	_, err = client.Status(ctx, clientConfig.Endpoints[0])
-	if err != nil {
-		log.Logger.Error().Str(log.KEY_PKG, PKG_ETCD).Err(err).Msg("Connection test failed")
+	// Test the connection with a quick status check against every endpoint,
+	// at least one of them has to answer
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("Testing connection with status check")
+	var lastErr error
+	reachable := 0
+	for _, status := range c.EndpointStatuses(context.Background()) {
+		if status.Err != nil {
+			log.Logger.Warn().Str(log.KEY_PKG, PKG_ETCD).Str("endpoint", status.Endpoint).Err(status.Err).Msg("Endpoint unreachable")
+			lastErr = status.Err
+			continue
+		}
+		reachable++
+	}
+	if reachable == 0 {
+		log.Logger.Error().Str(log.KEY_PKG, PKG_ETCD).Err(lastErr).Msg("Connection test failed")
 		client.Close()
-		return nil, fmt.Errorf("failed to connect to etcd: %w", err)
+		return nil, fmt.Errorf("failed to connect to etcd: %w", lastErr)
 	}
-	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("Connection test successful")
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Int("reachable", reachable).Msg("Connection test successful")
 
-	return &Client{client: client, config: clientConfig}, nil
+	return c, nil
 }
 
 // Close closes the etcd client
@@ -124,31 +133,81 @@ func (c *Client) Close() error {
 	return c.client.Close()
 }
 
-// Snapshot takes a snapshot of etcd and saves it to the specified path
-func (c *Client) Snapshot(ctx context.Context, snapshotPath string) error {
+// Snapshot takes a snapshot of etcd and saves it to the specified path.
+// The source endpoint is picked by the configured strategy; if streaming from it
+// fails, the next healthy endpoint is tried. Returns the status of the endpoint used.
+func (c *Client) Snapshot(ctx context.Context, snapshotPath string) (*EndpointStatus, error) {
+	return c.SnapshotPreferring(ctx, snapshotPath, "")
+}
+
+// SnapshotPreferring takes a snapshot like Snapshot, but tries the preferred endpoint
+// first while it is healthy, however the strategy ranks it now. It keeps the snapshot on
+// the member prepared for it, e.g. defragmented, when the ranking changed since.
+func (c *Client) SnapshotPreferring(ctx context.Context, snapshotPath, preferred string) (*EndpointStatus, error) {
 	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Str("snapshot_path", snapshotPath).Msg("Starting snapshot operation")
 
 	// Ensure directory exists
 	if err := os.MkdirAll(filepath.Dir(snapshotPath), 0755); err != nil {
-		return fmt.Errorf("failed to create snapshot directory: %w", err)
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
 	}
 	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("Snapshot directory created/verified")
 
-	// Get endpoints from existing client
-	endpoints := c.client.Endpoints()
-	if len(endpoints) == 0 {
-		return fmt.Errorf("no endpoints configured")
+	candidates, err := c.SnapshotCandidates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	candidates = preferEndpoint(candidates, preferred)
+
+	var lastErr error
+	for _, candidate := range candidates {
+		if err := c.snapshotFrom(ctx, candidate.Endpoint, snapshotPath); err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			log.Logger.Warn().Str(log.KEY_PKG, PKG_ETCD).Str("endpoint", candidate.Endpoint).Err(err).Msg("Snapshot failed, trying next endpoint")
+			continue
+		}
+
+		log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Str("endpoint", candidate.Endpoint).Msg("Snapshot completed successfully")
+		return &candidate, nil
+	}
+
+	return nil, fmt.Errorf("failed to save snapshot: %w", lastErr)
+}
+
+// SnapshotCandidates returns the healthy endpoints ordered by the configured snapshot strategy
+func (c *Client) SnapshotCandidates(ctx context.Context) ([]EndpointStatus, error) {
+	if len(c.client.Endpoints()) == 0 {
+		return nil, fmt.Errorf("no endpoints configured")
 	}
-	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Str("endpoint", endpoints[0]).Msg("Using endpoint for snapshot")
+
+	candidates, err := RankEndpoints(c.EndpointStatuses(ctx), c.strategy)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no healthy endpoints available for snapshot")
+	}
+
+	return candidates, nil
+}
+
+// snapshotFrom streams a snapshot from a single endpoint
+func (c *Client) snapshotFrom(ctx context.Context, endpoint, snapshotPath string) error {
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Str("endpoint", endpoint).Msg("Using endpoint for snapshot")
 
 	// Create config for snapshot based on original config
 	// snapshot must use single endpoint
 	snapshotConfig := clientv3.Config{
-		Endpoints:   []string{endpoints[0]},
-		DialTimeout: c.config.DialTimeout,
-		Username:    c.config.Username,
-		Password:    c.config.Password,
-		TLS:         c.config.TLS, // Preserve TLS configuration
+		Endpoints:            []string{endpoint},
+		DialTimeout:          c.config.DialTimeout,
+		DialKeepAliveTime:    c.config.DialKeepAliveTime,
+		DialKeepAliveTimeout: c.config.DialKeepAliveTimeout,
+		MaxCallRecvMsgSize:   c.config.MaxCallRecvMsgSize,
+		Username:             c.config.Username,
+		Password:             c.config.Password,
+		TLS:                  c.config.TLS, // Preserve TLS configuration
 	}
 
 	hasTLS := snapshotConfig.TLS != nil
@@ -157,25 +216,29 @@ func (c *Client) Snapshot(ctx context.Context, snapshotPath string) error {
 		log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).
 			Bool("insecure_skip_verify", snapshotConfig.TLS.InsecureSkipVerify).
 			Bool("has_root_cas", snapshotConfig.TLS.RootCAs != nil).
-			Int("client_cert_count", len(snapshotConfig.TLS.Certificates)).
+			Bool("has_client_cert", snapshotConfig.TLS.GetClientCertificate != nil).
+			Str("server_name", snapshotConfig.TLS.ServerName).
 			Msg("TLS configuration details")
 	}
 
 	// Use the new snapshot API
 	logger := zap.NewNop()
 	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("Calling snapshot.SaveWithVersion")
-	_, err := snapshot.SaveWithVersion(ctx, logger, snapshotConfig, snapshotPath)
-	if err != nil {
-		log.Logger.Error().Str(log.KEY_PKG, PKG_ETCD).Err(err).Msg("Snapshot failed")
-		return fmt.Errorf("failed to save snapshot: %w", err)
+	if _, err := snapshot.SaveWithVersion(ctx, logger, snapshotConfig, snapshotPath); err != nil {
+		// Drop the partial download so the next attempt starts clean
+		_ = os.Remove(snapshotPath + ".part")
+		return err
 	}
 
-	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("Snapshot completed successfully")
 	return nil
 }
 
 // RestoreSnapshot restores etcd from a snapshot using etcdutl library without requiring a client connection
 func RestoreSnapshot(ctx context.Context, opts RestoreOptions) error {
+	if (opts.RevisionBump > 0) != opts.MarkCompacted {
+		return fmt.Errorf("revision bump and mark compacted must be used together")
+	}
+
 	// Convert snapshot path to absolute path to handle working directory changes
 	snapshotPath := opts.SnapshotPath
 	if !filepath.IsAbs(snapshotPath) {
@@ -196,14 +259,26 @@ func RestoreSnapshot(ctx context.Context, opts RestoreOptions) error {
 		dataDir = absPath
 	}
 
+	layoutWALDir := opts.Layout.WALDir
+	if layoutWALDir != "" && !filepath.IsAbs(layoutWALDir) {
+		absPath, err := filepath.Abs(layoutWALDir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve absolute path for WAL directory: %w", err)
+		}
+		layoutWALDir = absPath
+	}
+	walDir, err := restoreWALDir(layoutWALDir)
+	if err != nil {
+		return err
+	}
+
 	// Create snapshot manager
 	logger := zap.NewNop()
 	manager := etcdutlSnapshot.NewV3(logger)
 
-	// Parse peer URLs from string
-	var peerURLs []string
-	if opts.InitialAdvertisePeerURLs != "" {
-		peerURLs = []string{opts.InitialAdvertisePeerURLs}
+	token := opts.InitialClusterToken
+	if token == "" {
+		token = DefaultClusterToken
 	}
 
 	// Configure restore options
@@ -211,10 +286,13 @@ func RestoreSnapshot(ctx context.Context, opts RestoreOptions) error {
 		SnapshotPath:        snapshotPath,
 		Name:                opts.Name,
 		OutputDataDir:       dataDir,
-		PeerURLs:            peerURLs,
+		OutputWALDir:        walDir,
+		PeerURLs:            opts.InitialAdvertisePeerURLs,
 		InitialCluster:      opts.InitialCluster,
-		InitialClusterToken: "etcd-cluster",
+		InitialClusterToken: token,
 		SkipHashCheck:       opts.SkipHashCheck,
+		RevisionBump:        opts.RevisionBump,
+		MarkCompacted:       opts.MarkCompacted,
 	}
 
 	// Set default name if not provided
@@ -222,7 +300,10 @@ func RestoreSnapshot(ctx context.Context, opts RestoreOptions) error {
 		restoreConfig.Name = "default"
 	}
 
-	// Set default initial cluster if not provided
+	// Set default peer URLs and initial cluster if not provided
+	if len(restoreConfig.PeerURLs) == 0 {
+		restoreConfig.PeerURLs = []string{"http://localhost:2380"}
+	}
 	if restoreConfig.InitialCluster == "" {
 		restoreConfig.InitialCluster = fmt.Sprintf("%s=http://localhost:2380", restoreConfig.Name)
 	}
@@ -231,11 +312,90 @@ func RestoreSnapshot(ctx context.Context, opts RestoreOptions) error {
 	if err := manager.Restore(restoreConfig); err != nil {
 		return fmt.Errorf("failed to restore snapshot: %w", err)
 	}
+	if walDir != layoutWALDir {
+		if err := moveWAL(walDir, layoutWALDir); err != nil {
+			return err
+		}
+	}
 
+	owner := opts.Layout.Owner
+	if owner == nil && opts.Layout.DirMode == 0 {
+		return nil
+	}
+	if owner == nil {
+		owner = &Owner{UID: -1, GID: -1}
+	}
+	for _, dir := range []string{dataDir, layoutWALDir} {
+		if dir == "" {
+			continue
+		}
+		if err := datadir.SetOwner(dir, owner.UID, owner.GID, opts.Layout.DirMode); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// restoreWALDir returns the directory etcdutl writes the WAL to. etcdutl refuses an
+// existing WAL directory, but a separate WAL disk is usually an existing mount point, so
+// an empty existing directory gets the WAL written to a temporary directory inside it.
+func restoreWALDir(walDir string) (string, error) {
+	if walDir == "" {
+		return "", nil
+	}
+
+	entries, err := os.ReadDir(walDir)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return walDir, nil
+	case err != nil:
+		return "", fmt.Errorf("failed to read WAL directory %s: %w", walDir, err)
+	case len(entries) > 0:
+		return "", fmt.Errorf("WAL directory %s is not empty", walDir)
+	}
+	return filepath.Join(walDir, ".restore"), nil
+}
+
+// moveWAL moves the WAL files restored to tmpDir up into walDir, on the same file system
+func moveWAL(tmpDir, walDir string) error {
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		return fmt.Errorf("failed to read restored WAL: %w", err)
+	}
+	for _, entry := range entries {
+		if err := os.Rename(filepath.Join(tmpDir, entry.Name()), filepath.Join(walDir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to move restored WAL: %w", err)
+		}
+	}
+	return os.Remove(tmpDir)
+}
+
 // RemoveSnapshot removes a local snapshot file
 func (c *Client) RemoveSnapshot(snapshotPath string) error {
 	return os.Remove(snapshotPath)
 }
+
+// SnapshotStatus holds information read from a snapshot file
+type SnapshotStatus struct {
+	Hash      uint32 `json:"hash"`
+	Revision  int64  `json:"revision"`
+	TotalKey  int    `json:"total_key"`
+	TotalSize int64  `json:"total_size"`
+	Version   string `json:"version,omitempty"`
+}
+
+// ReadSnapshotStatus reads revision, key count and hash from an uncompressed snapshot file
+func ReadSnapshotStatus(snapshotPath string) (*SnapshotStatus, error) {
+	status, err := etcdutlSnapshot.NewV3(zap.NewNop()).Status(snapshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot status: %w", err)
+	}
+
+	return &SnapshotStatus{
+		Hash:      status.Hash,
+		Revision:  status.Revision,
+		TotalKey:  status.TotalKey,
+		TotalSize: status.TotalSize,
+		Version:   status.Version,
+	}, nil
+}
@@ -0,0 +1,189 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+)
+
+func TestClient_SnapshotAndRestore(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.Config{})
+
+	keys := map[string]string{
+		"/app/a": "1",
+		"/app/b": "2",
+		"/other": "3",
+	}
+	srv.PutKeys(t, keys)
+
+	client, err := NewClient(appconfig.EtcdConfig{Endpoints: []string{srv.Endpoint}})
+	require.NoError(t, err)
+	defer client.Close()
+
+	snapshotPath := filepath.Join(t.TempDir(), "snapshots", "test-snapshot.db")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	source, err := client.Snapshot(ctx, snapshotPath)
+	require.NoError(t, err)
+	assert.Equal(t, srv.Endpoint, source.Endpoint)
+
+	info, err := os.Stat(snapshotPath)
+	require.NoError(t, err)
+	assert.Positive(t, info.Size())
+
+	// Stop the source so the restored member cannot talk to it
+	srv.Stop()
+
+	peerURL := etcdtest.FreeURL(t)
+	dataDir := filepath.Join(t.TempDir(), "restored")
+	err = RestoreSnapshot(context.Background(), RestoreOptions{
+		SnapshotPath:             snapshotPath,
+		DataDir:                  dataDir,
+		Name:                     "restored",
+		InitialCluster:           "restored=" + peerURL,
+		InitialAdvertisePeerURLs: []string{peerURL},
+	})
+	require.NoError(t, err)
+
+	restored := etcdtest.Start(t, etcdtest.Config{Name: "restored", DataDir: dataDir, PeerURL: peerURL})
+	assert.Equal(t, keys, restored.GetKeys(t, "/"))
+}
+
+func TestClient_CheckHealth(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.Config{})
+
+	client, err := NewClient(appconfig.EtcdConfig{Endpoints: []string{srv.Endpoint}})
+	require.NoError(t, err)
+	defer client.Close()
+
+	report := client.CheckHealth(context.Background(), 1000)
+	assert.True(t, report.Healthy, "problems: %v", report.Problems)
+	assert.NotZero(t, report.Leader)
+	require.Len(t, report.Endpoints, 1)
+	assert.True(t, report.Endpoints[0].Leader)
+	assert.Empty(t, report.Alarms)
+}
+
+func TestClient_CompactAndDefragment(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.Config{})
+	for i := 0; i < 10; i++ {
+		srv.PutKeys(t, map[string]string{"/counter": fmt.Sprint(i)})
+	}
+
+	client, err := NewClient(appconfig.EtcdConfig{Endpoints: []string{srv.Endpoint}})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+	revision, err := client.Compact(ctx, 5)
+	require.NoError(t, err)
+	assert.Positive(t, revision)
+
+	// Compacting again to the same point is not an error
+	_, err = client.Compact(ctx, 5)
+	require.NoError(t, err)
+
+	// Retaining more revisions than exist is a no-op
+	revision, err = client.Compact(ctx, 1000)
+	require.NoError(t, err)
+	assert.Zero(t, revision)
+
+	require.NoError(t, client.Defragment(ctx, srv.Endpoint))
+	assert.Equal(t, map[string]string{"/counter": "9"}, srv.GetKeys(t, "/"))
+}
+
+func TestNewClient_RequestTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := NewClient(appconfig.EtcdConfig{
+		Endpoints:      []string{etcdtest.FreeURL(t)},
+		DialTimeout:    200 * time.Millisecond,
+		RequestTimeout: 200 * time.Millisecond,
+	})
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestRestoreSnapshot_Layout(tMain *testing.T) {
+	srv := etcdtest.Start(tMain, etcdtest.Config{})
+	keys := map[string]string{"/app/a": "1"}
+	srv.PutKeys(tMain, keys)
+
+	client, err := NewClient(appconfig.EtcdConfig{Endpoints: []string{srv.Endpoint}})
+	require.NoError(tMain, err)
+	defer client.Close()
+	snapshotPath := filepath.Join(tMain.TempDir(), "layout.db")
+	_, err = client.Snapshot(context.Background(), snapshotPath)
+	require.NoError(tMain, err)
+
+	tests := []struct {
+		name       string
+		createWAL  bool
+		walEntries bool
+		wantErr    bool
+	}{
+		{name: "missing WAL dir"},
+		{name: "empty WAL dir, like a mount point", createWAL: true},
+		{name: "non-empty WAL dir", createWAL: true, walEntries: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tMain.Run(tt.name, func(t *testing.T) {
+			dataDir := filepath.Join(t.TempDir(), "data")
+			walDir := filepath.Join(t.TempDir(), "wal")
+			if tt.createWAL {
+				require.NoError(t, os.MkdirAll(walDir, 0755))
+			}
+			if tt.walEntries {
+				require.NoError(t, os.WriteFile(filepath.Join(walDir, "0.wal"), nil, 0600))
+			}
+
+			peerURL := etcdtest.FreeURL(t)
+			err := RestoreSnapshot(context.Background(), RestoreOptions{
+				SnapshotPath:             snapshotPath,
+				DataDir:                  dataDir,
+				Name:                     "layout",
+				InitialCluster:           "layout=" + peerURL,
+				InitialAdvertisePeerURLs: []string{peerURL},
+				Layout: MemberLayout{
+					WALDir:  walDir,
+					Owner:   &Owner{UID: os.Getuid(), GID: os.Getgid()},
+					DirMode: 0750,
+				},
+			})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.NoDirExists(t, filepath.Join(dataDir, "member", "wal"))
+			wals, err := filepath.Glob(filepath.Join(walDir, "*.wal"))
+			require.NoError(t, err)
+			assert.NotEmpty(t, wals)
+			for _, dir := range []string{dataDir, walDir} {
+				info, err := os.Stat(dir)
+				require.NoError(t, err)
+				assert.Equal(t, os.FileMode(0750), info.Mode().Perm(), dir)
+			}
+
+			restored := etcdtest.Start(t, etcdtest.Config{Name: "layout", DataDir: dataDir, WALDir: walDir, PeerURL: peerURL})
+			assert.Equal(t, keys, restored.GetKeys(t, "/"))
+		})
+	}
+}
+
+func TestRestoreSnapshot_MissingSnapshot(t *testing.T) {
+	err := RestoreSnapshot(context.Background(), RestoreOptions{
+		SnapshotPath: filepath.Join(t.TempDir(), "missing.db"),
+		DataDir:      filepath.Join(t.TempDir(), "data"),
+	})
+	assert.Error(t, err)
+}
@@ -185,7 +185,7 @@ func TestNewClient_TLSInsecure(t *testing.T) {
 		Endpoints: []string{"https://localhost:2379"},
 		CertFile:  certFile,
 		KeyFile:   keyFile,
-		// No CA file - should use insecure skip verify
+		// No CA file - the system root pool is used for verification
 	}
 
 	// This should not fail even though etcd server is not running
@@ -264,9 +264,12 @@ func TestTLSConfigSetup(tMain *testing.T) {
 
 	tests := []struct {
 		name              string
+		endpoint          string
 		caFile            string
 		certFile          string
 		keyFile           string
+		insecure          bool
+		serverName        string
 		expectTLS         bool
 		expectInsecure    bool
 		expectClientCerts bool
@@ -285,11 +288,11 @@ func TestTLSConfigSetup(tMain *testing.T) {
 			expectRootCAs:     true,
 		},
 		{
-			name:              "Client cert without CA",
+			name:              "Client cert without CA uses system roots",
 			certFile:          certFile,
 			keyFile:           keyFile,
 			expectTLS:         true,
-			expectInsecure:    true,
+			expectInsecure:    false,
 			expectClientCerts: true,
 			expectRootCAs:     false,
 		},
@@ -303,61 +306,153 @@ func TestTLSConfigSetup(tMain *testing.T) {
 			expectClientCerts: true,
 			expectRootCAs:     true,
 		},
+		{
+			name:              "Explicit insecure skip verify",
+			certFile:          certFile,
+			keyFile:           keyFile,
+			insecure:          true,
+			expectTLS:         true,
+			expectInsecure:    true,
+			expectClientCerts: true,
+			expectRootCAs:     false,
+		},
+		{
+			name:       "Server name override",
+			serverName: "etcd.internal",
+			expectTLS:  true,
+		},
+		{
+			name:      "https endpoint without files",
+			endpoint:  "https://localhost:2379",
+			expectTLS: true,
+		},
 	}
 
 	for _, tt := range tests {
 		tMain.Run(tt.name, func(t *testing.T) {
+			endpoint := tt.endpoint
+			if endpoint == "" {
+				endpoint = "localhost:2379"
+			}
 			cfg := appconfig.EtcdConfig{
-				Endpoints: []string{"localhost:2379"}, // Use non-TLS endpoint to avoid connection issues
-				CaFile:    tt.caFile,
-				CertFile:  tt.certFile,
-				KeyFile:   tt.keyFile,
+				Endpoints:          []string{endpoint},
+				CaFile:             tt.caFile,
+				CertFile:           tt.certFile,
+				KeyFile:            tt.keyFile,
+				InsecureSkipVerify: tt.insecure,
+				ServerName:         tt.serverName,
+			}
+
+			tlsConfig, err := buildTLSConfig(cfg)
+			require.NoError(t, err)
+
+			if !tt.expectTLS {
+				assert.Nil(t, tlsConfig)
+				return
 			}
 
-			// Test just the TLS configuration setup without actually connecting
-			if tt.expectTLS {
-				// Create a tls.Config manually to test the logic
-				var tlsConfig *tls.Config
-
-				if cfg.CertFile != "" && cfg.KeyFile != "" || cfg.CaFile != "" {
-					tlsConfig = &tls.Config{}
-
-					if cfg.CertFile != "" && cfg.KeyFile != "" {
-						cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
-						require.NoError(t, err)
-						tlsConfig.Certificates = []tls.Certificate{cert}
-					}
-
-					if cfg.CaFile != "" {
-						caCert, err := os.ReadFile(cfg.CaFile)
-						require.NoError(t, err)
-
-						caCertPool := x509.NewCertPool()
-						ok := caCertPool.AppendCertsFromPEM(caCert)
-						require.True(t, ok)
-
-						tlsConfig.RootCAs = caCertPool
-						tlsConfig.InsecureSkipVerify = false
-					} else {
-						tlsConfig.InsecureSkipVerify = true
-					}
-				}
-
-				require.NotNil(t, tlsConfig)
-				assert.Equal(t, tt.expectInsecure, tlsConfig.InsecureSkipVerify)
-
-				if tt.expectClientCerts {
-					assert.NotEmpty(t, tlsConfig.Certificates)
-				} else {
-					assert.Empty(t, tlsConfig.Certificates)
-				}
-
-				if tt.expectRootCAs {
-					assert.NotNil(t, tlsConfig.RootCAs)
-				} else {
-					assert.Nil(t, tlsConfig.RootCAs)
-				}
+			require.NotNil(t, tlsConfig)
+			// With a CA file the standard verification is replaced by VerifyConnection
+			assert.Equal(t, tt.expectInsecure, tlsConfig.InsecureSkipVerify && tlsConfig.VerifyConnection == nil)
+			assert.Equal(t, tt.serverName, tlsConfig.ServerName)
+			assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+
+			if tt.expectClientCerts {
+				require.NotNil(t, tlsConfig.GetClientCertificate)
+				cert, err := tlsConfig.GetClientCertificate(nil)
+				require.NoError(t, err)
+				assert.NotEmpty(t, cert.Certificate)
+			} else {
+				assert.Nil(t, tlsConfig.GetClientCertificate)
 			}
+
+			if tt.expectRootCAs {
+				assert.NotNil(t, tlsConfig.VerifyConnection)
+			} else {
+				assert.Nil(t, tlsConfig.VerifyConnection)
+			}
+			assert.Nil(t, tlsConfig.RootCAs)
 		})
 	}
 }
+
+func TestTLSConfig_VersionAndCipherSuites(t *testing.T) {
+	cfg := appconfig.EtcdConfig{
+		Endpoints:       []string{"https://localhost:2379"},
+		TLSMinVersion:   "1.3",
+		TLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+	}
+
+	tlsConfig, err := buildTLSConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, tlsConfig.CipherSuites)
+
+	cfg.TLSCipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"}
+	_, err = buildTLSConfig(cfg)
+	assert.ErrorContains(t, err, "unsupported or insecure TLS cipher suite")
+
+	cfg.TLSCipherSuites = nil
+	cfg.TLSMinVersion = "1.0"
+	_, err = buildTLSConfig(cfg)
+	assert.ErrorContains(t, err, "unsupported minimum TLS version")
+}
+
+func TestCertReloader_ReloadsChangedFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	_, certFile, keyFile := generateTestCertificates(t, tempDir)
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	first, err := reloader.GetClientCertificate(nil)
+	require.NoError(t, err)
+
+	// Replace the key pair on disk with a new one and bump its modification time
+	otherDir := t.TempDir()
+	_, newCertFile, newKeyFile := generateTestCertificates(t, otherDir)
+	for src, dst := range map[string]string{newCertFile: certFile, newKeyFile: keyFile} {
+		data, err := os.ReadFile(src)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(dst, data, 0600))
+		future := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(dst, future, future))
+	}
+
+	second, err := reloader.GetClientCertificate(nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Certificate[0], second.Certificate[0])
+}
+
+func TestCAReloader_ReloadsChangedFile(t *testing.T) {
+	caFile, _, _ := generateTestCertificates(t, t.TempDir())
+	otherCAFile, _, _ := generateTestCertificates(t, t.TempDir())
+
+	// readCert parses the CA certificate of a file, a CA is valid as a server leaf for itself
+	readCert := func(file string) *x509.Certificate {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		block, _ := pem.Decode(data)
+		require.NotNil(t, block)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		return cert
+	}
+	first := tls.ConnectionState{PeerCertificates: []*x509.Certificate{readCert(caFile)}}
+	second := tls.ConnectionState{PeerCertificates: []*x509.Certificate{readCert(otherCAFile)}}
+
+	reloader, err := newCAReloader(caFile)
+	require.NoError(t, err)
+	assert.NoError(t, reloader.VerifyConnection(first))
+	assert.Error(t, reloader.VerifyConnection(second))
+
+	// Rotate the CA on disk and bump its modification time
+	data, err := os.ReadFile(otherCAFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(caFile, data, 0600))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(caFile, future, future))
+
+	assert.Error(t, reloader.VerifyConnection(first))
+	assert.NoError(t, reloader.VerifyConnection(second))
+}
@@ -0,0 +1,152 @@
+package etcd
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// Snapshot source selection strategies
+const (
+	StrategyFirst       = "first"
+	StrategyFollower    = "follower"
+	StrategyLeader      = "leader"
+	StrategySmallestDB  = "smallest-db"
+	StrategyLatestIndex = "latest-index"
+)
+
+// EndpointStatus holds the status reported by a single etcd endpoint
+type EndpointStatus struct {
+	Endpoint  string
+	ClusterID uint64
+	MemberID  uint64
+	Leader    uint64
+	DBSize    int64
+	RaftIndex uint64
+	RaftTerm  uint64
+	Revision  int64
+	Errors    []string
+	Err       error
+}
+
+// Healthy reports whether the endpoint answered and reported no errors
+func (s EndpointStatus) Healthy() bool {
+	return s.Err == nil && len(s.Errors) == 0
+}
+
+// IsLeader reports whether the endpoint is the current raft leader
+func (s EndpointStatus) IsLeader() bool {
+	return s.Err == nil && s.MemberID != 0 && s.MemberID == s.Leader
+}
+
+// EndpointStatuses queries Status on every configured endpoint concurrently.
+// The result is in the same order as the configured endpoints.
+func (c *Client) EndpointStatuses(ctx context.Context) []EndpointStatus {
+	endpoints := c.client.Endpoints()
+	statuses := make([]EndpointStatus, len(endpoints))
+
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = c.endpointStatus(ctx, endpoint)
+		}()
+	}
+	wg.Wait()
+
+	return statuses
+}
+
+// endpointStatus queries Status on a single endpoint
+func (c *Client) endpointStatus(ctx context.Context, endpoint string) EndpointStatus {
+	statusCtx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	status := EndpointStatus{Endpoint: endpoint}
+	resp, err := c.client.Status(statusCtx, endpoint)
+	if err != nil {
+		log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Str("endpoint", endpoint).Err(err).Msg("Endpoint status check failed")
+		status.Err = err
+		return status
+	}
+
+	status.ClusterID = resp.Header.ClusterId
+	status.MemberID = resp.Header.MemberId
+	status.Leader = resp.Leader
+	status.DBSize = resp.DbSize
+	status.RaftIndex = resp.RaftIndex
+	status.RaftTerm = resp.RaftTerm
+	status.Revision = resp.Header.Revision
+	status.Errors = resp.Errors
+
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).
+		Str("endpoint", endpoint).
+		Bool("leader", status.IsLeader()).
+		Int64("db_size", status.DBSize).
+		Uint64("raft_index", status.RaftIndex).
+		Int64("revision", status.Revision).
+		Msg("Endpoint status")
+
+	return status
+}
+
+// RankEndpoints orders the healthy endpoints by preference for the given strategy.
+// Unhealthy endpoints are dropped; ties keep the configured endpoint order.
+func RankEndpoints(statuses []EndpointStatus, strategy string) ([]EndpointStatus, error) {
+	var healthy []EndpointStatus
+	for _, status := range statuses {
+		if status.Healthy() {
+			healthy = append(healthy, status)
+		}
+	}
+
+	var order func(a, b EndpointStatus) int
+	switch strategy {
+	case "", StrategyFirst:
+		order = func(a, b EndpointStatus) int { return 0 }
+	case StrategyFollower:
+		order = func(a, b EndpointStatus) int { return boolCmp(a.IsLeader(), b.IsLeader()) }
+	case StrategyLeader:
+		order = func(a, b EndpointStatus) int { return boolCmp(b.IsLeader(), a.IsLeader()) }
+	case StrategySmallestDB:
+		order = func(a, b EndpointStatus) int { return cmp.Compare(a.DBSize, b.DBSize) }
+	case StrategyLatestIndex:
+		order = func(a, b EndpointStatus) int { return cmp.Compare(b.RaftIndex, a.RaftIndex) }
+	default:
+		return nil, fmt.Errorf("unknown snapshot endpoint strategy: %s", strategy)
+	}
+
+	slices.SortStableFunc(healthy, order)
+	return healthy, nil
+}
+
+// boolCmp orders false before true
+func boolCmp(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// preferEndpoint moves the status of the preferred endpoint to the front of ranked.
+// Ranked is returned unchanged when preferred is empty or not among the healthy endpoints.
+func preferEndpoint(ranked []EndpointStatus, preferred string) []EndpointStatus {
+	if preferred == "" {
+		return ranked
+	}
+	idx := slices.IndexFunc(ranked, func(status EndpointStatus) bool { return status.Endpoint == preferred })
+	if idx < 0 {
+		log.Logger.Warn().Str(log.KEY_PKG, PKG_ETCD).Str("endpoint", preferred).Msg("Preferred snapshot endpoint is not healthy, using the next ranked endpoint")
+		return ranked
+	}
+	return slices.Concat(ranked[idx:idx+1], ranked[:idx], ranked[idx+1:])
+}
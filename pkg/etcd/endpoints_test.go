@@ -0,0 +1,66 @@
+package etcd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRankEndpoints(tMain *testing.T) {
+	statuses := []EndpointStatus{
+		{Endpoint: "a", MemberID: 1, Leader: 2, DBSize: 300, RaftIndex: 10},
+		{Endpoint: "b", MemberID: 2, Leader: 2, DBSize: 100, RaftIndex: 12},
+		{Endpoint: "c", Err: errors.New("connection refused")},
+		{Endpoint: "d", MemberID: 4, Leader: 2, DBSize: 200, RaftIndex: 11},
+		{Endpoint: "e", MemberID: 5, Leader: 2, Errors: []string{"NOSPACE"}},
+	}
+
+	tests := []struct {
+		name     string
+		strategy string
+		expected []string
+	}{
+		{name: "first", strategy: StrategyFirst, expected: []string{"a", "b", "d"}},
+		{name: "default", strategy: "", expected: []string{"a", "b", "d"}},
+		{name: "follower", strategy: StrategyFollower, expected: []string{"a", "d", "b"}},
+		{name: "leader", strategy: StrategyLeader, expected: []string{"b", "a", "d"}},
+		{name: "smallest db", strategy: StrategySmallestDB, expected: []string{"b", "d", "a"}},
+		{name: "latest index", strategy: StrategyLatestIndex, expected: []string{"b", "d", "a"}},
+	}
+
+	for _, tt := range tests {
+		tMain.Run(tt.name, func(t *testing.T) {
+			ranked, err := RankEndpoints(statuses, tt.strategy)
+			require.NoError(t, err)
+
+			var endpoints []string
+			for _, status := range ranked {
+				endpoints = append(endpoints, status.Endpoint)
+			}
+			assert.Equal(t, tt.expected, endpoints)
+		})
+	}
+
+	_, err := RankEndpoints(statuses, "random")
+	assert.Error(tMain, err)
+}
+
+func TestPreferEndpoint(t *testing.T) {
+	ranked := []EndpointStatus{{Endpoint: "b"}, {Endpoint: "d"}, {Endpoint: "a"}}
+	endpoints := func(statuses []EndpointStatus) []string {
+		var names []string
+		for _, status := range statuses {
+			names = append(names, status.Endpoint)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"a", "b", "d"}, endpoints(preferEndpoint(ranked, "a")), "defragmented member fell behind")
+	assert.Equal(t, []string{"d", "b", "a"}, endpoints(preferEndpoint(ranked, "d")))
+	assert.Equal(t, []string{"b", "d", "a"}, endpoints(preferEndpoint(ranked, "b")))
+	assert.Equal(t, []string{"b", "d", "a"}, endpoints(preferEndpoint(ranked, "")))
+	assert.Equal(t, []string{"b", "d", "a"}, endpoints(preferEndpoint(ranked, "c")), "unhealthy preferred endpoint")
+	assert.Equal(t, []string{"b", "d", "a"}, endpoints(ranked), "ranked is left unchanged")
+}
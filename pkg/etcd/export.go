@@ -0,0 +1,164 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/thedataflows/etcd2s3/pkg/compression"
+	log "github.com/thedataflows/go-lib-log"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ExportExt is the file extension of logical key exports
+const ExportExt = ".ndjson"
+
+// defaultExportPageSize is the number of keys fetched per request when not configured
+const defaultExportPageSize = 1000
+
+// KeyRecord is a single key written to a logical export, one JSON object per line.
+// Keys are written as plain strings; keys that are not valid UTF-8 are written
+// base64 encoded in KeyBase64 instead. Values are always base64 encoded.
+type KeyRecord struct {
+	Key            string `json:"key,omitempty"`
+	KeyBase64      []byte `json:"key_base64,omitempty"`
+	Value          []byte `json:"value"`
+	CreateRevision int64  `json:"create_revision"`
+	ModRevision    int64  `json:"mod_revision"`
+	Version        int64  `json:"version"`
+	Lease          int64  `json:"lease,omitempty"`
+}
+
+// NewKeyRecord converts an etcd key-value into an export record
+func NewKeyRecord(kv *mvccpb.KeyValue) KeyRecord {
+	record := KeyRecord{
+		Value:          kv.Value,
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Version:        kv.Version,
+		Lease:          kv.Lease,
+	}
+	if utf8.Valid(kv.Key) {
+		record.Key = string(kv.Key)
+	} else {
+		record.KeyBase64 = kv.Key
+	}
+	return record
+}
+
+// KeyBytes returns the raw key of the record
+func (r KeyRecord) KeyBytes() []byte {
+	if r.KeyBase64 != nil {
+		return r.KeyBase64
+	}
+	return []byte(r.Key)
+}
+
+// ExportOptions selects the keys to export
+type ExportOptions struct {
+	// Prefix exports every key with this prefix
+	Prefix string
+	// From is the first key of the range (inclusive), used when Prefix is empty
+	From string
+	// To is the end of the range (exclusive). Empty means every key from From onward.
+	To string
+	// Revision to read at, 0 means the current revision
+	Revision int64
+	// PageSize is the number of keys fetched per request
+	PageSize int64
+}
+
+// ExportResult describes a completed export
+type ExportResult struct {
+	Revision int64
+	Keys     int
+}
+
+// keyRange returns the start and end keys of the range selected by the options.
+// Without a prefix or range the whole keyspace is selected.
+func (o ExportOptions) keyRange() (string, string) {
+	switch {
+	case o.Prefix != "":
+		return o.Prefix, clientv3.GetPrefixRangeEnd(o.Prefix)
+	case o.From != "" && o.To != "":
+		return o.From, o.To
+	case o.From != "":
+		return o.From, "\x00"
+	default:
+		return "\x00", "\x00"
+	}
+}
+
+// Export writes the selected keys to w as NDJSON. Pages are read with WithRev at the
+// revision of the first page (or opts.Revision), so the export is a consistent view
+// of the keyspace even while the cluster keeps changing.
+func (c *Client) Export(ctx context.Context, w io.Writer, opts ExportOptions) (*ExportResult, error) {
+	encoder := json.NewEncoder(w)
+	return c.Range(ctx, opts, func(kv *mvccpb.KeyValue) error {
+		if err := encoder.Encode(NewKeyRecord(kv)); err != nil {
+			return fmt.Errorf("failed to write export record: %w", err)
+		}
+		return nil
+	})
+}
+
+// Range calls fn for every selected key in key order, paging like Export does
+func (c *Client) Range(ctx context.Context, opts ExportOptions, fn func(kv *mvccpb.KeyValue) error) (*ExportResult, error) {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultExportPageSize
+	}
+
+	key, end := opts.keyRange()
+	result := &ExportResult{Revision: opts.Revision}
+
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Str("key", key).Str("range_end", end).Int64("revision", opts.Revision).Int64("page_size", pageSize).Msg("Reading keys")
+
+	for {
+		getOpts := []clientv3.OpOption{clientv3.WithRange(end), clientv3.WithLimit(pageSize)}
+		if result.Revision > 0 {
+			getOpts = append(getOpts, clientv3.WithRev(result.Revision))
+		}
+
+		pageCtx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+		resp, err := c.client.Get(pageCtx, key, getOpts...)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keys at revision %d: %w", result.Revision, err)
+		}
+
+		// Pin every following page to the revision of the first one
+		if result.Revision == 0 {
+			result.Revision = resp.Header.Revision
+		}
+
+		for _, kv := range resp.Kvs {
+			if err := fn(kv); err != nil {
+				return nil, err
+			}
+		}
+		result.Keys += len(resp.Kvs)
+
+		if !resp.More || len(resp.Kvs) == 0 {
+			break
+		}
+		// Continue right after the last key of this page
+		key = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Int64("revision", result.Revision).Int("keys", result.Keys).Msg("Keys read")
+	return result, nil
+}
+
+// IsExportFile reports whether a file name is a logical export, compressed or not
+func IsExportFile(filename string) bool {
+	if compression.IsCompressed(filename) {
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	return filepath.Ext(filename) == ExportExt
+}
@@ -0,0 +1,127 @@
+package etcd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+// readExport decodes NDJSON export records into a key to value map
+func readExport(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+
+	keys := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var record KeyRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		assert.Positive(t, record.ModRevision)
+		keys[string(record.KeyBytes())] = string(record.Value)
+	}
+	require.NoError(t, scanner.Err())
+	return keys
+}
+
+func TestClient_Export(tMain *testing.T) {
+	srv := etcdtest.Start(tMain, etcdtest.Config{})
+	srv.PutKeys(tMain, map[string]string{
+		"/app-a/1": "a1",
+		"/app-a/2": "a2",
+		"/app-a/3": "a3",
+		"/app-b/1": "b1",
+		"/other":   "o",
+	})
+
+	client, err := NewClient(appconfig.EtcdConfig{Endpoints: []string{srv.Endpoint}})
+	require.NoError(tMain, err)
+	defer client.Close()
+
+	tests := []struct {
+		name     string
+		opts     ExportOptions
+		expected map[string]string
+	}{
+		{
+			name:     "prefix with paging",
+			opts:     ExportOptions{Prefix: "/app-a/", PageSize: 2},
+			expected: map[string]string{"/app-a/1": "a1", "/app-a/2": "a2", "/app-a/3": "a3"},
+		},
+		{
+			name:     "range",
+			opts:     ExportOptions{From: "/app-a/2", To: "/app-b/2"},
+			expected: map[string]string{"/app-a/2": "a2", "/app-a/3": "a3", "/app-b/1": "b1"},
+		},
+		{
+			name:     "from onward",
+			opts:     ExportOptions{From: "/app-b/"},
+			expected: map[string]string{"/app-b/1": "b1", "/other": "o"},
+		},
+		{
+			name: "everything",
+			opts: ExportOptions{PageSize: 1},
+			expected: map[string]string{
+				"/app-a/1": "a1", "/app-a/2": "a2", "/app-a/3": "a3", "/app-b/1": "b1", "/other": "o",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tMain.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			result, err := client.Export(context.Background(), &buf, tt.opts)
+			require.NoError(t, err)
+			assert.Positive(t, result.Revision)
+			assert.Equal(t, len(tt.expected), result.Keys)
+			assert.Equal(t, tt.expected, readExport(t, buf.Bytes()))
+		})
+	}
+}
+
+func TestClient_ExportAtRevision(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.Config{})
+	srv.PutKeys(t, map[string]string{"/app/key": "old"})
+
+	client, err := NewClient(appconfig.EtcdConfig{Endpoints: []string{srv.Endpoint}})
+	require.NoError(t, err)
+	defer client.Close()
+
+	var buf bytes.Buffer
+	first, err := client.Export(context.Background(), &buf, ExportOptions{Prefix: "/app/"})
+	require.NoError(t, err)
+
+	srv.PutKeys(t, map[string]string{"/app/key": "new", "/app/added": "x"})
+
+	buf.Reset()
+	result, err := client.Export(context.Background(), &buf, ExportOptions{Prefix: "/app/", Revision: first.Revision})
+	require.NoError(t, err)
+	assert.Equal(t, first.Revision, result.Revision)
+	assert.Equal(t, map[string]string{"/app/key": "old"}, readExport(t, buf.Bytes()))
+}
+
+func TestKeyRecord_BinaryKey(t *testing.T) {
+	record := NewKeyRecord(&mvccpb.KeyValue{Key: []byte{0xff, 0x00, 'a'}, Value: []byte("v")})
+	assert.Empty(t, record.Key)
+
+	data, err := json.Marshal(record)
+	require.NoError(t, err)
+
+	var decoded KeyRecord
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, []byte{0xff, 0x00, 'a'}, decoded.KeyBytes())
+	assert.Equal(t, []byte("v"), decoded.Value)
+}
+
+func TestIsExportFile(t *testing.T) {
+	assert.True(t, IsExportFile("etcd-export-20250101-000000.ndjson"))
+	assert.True(t, IsExportFile("etcd-export-20250101-000000.ndjson.zst"))
+	assert.False(t, IsExportFile("etcd-snapshot-20250101-000000.db.zst"))
+	assert.False(t, IsExportFile("etcd-snapshot-20250101-000000.db"))
+}
@@ -0,0 +1,111 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// HealthReport summarizes cluster health as seen from the configured endpoints
+type HealthReport struct {
+	Healthy         bool             `json:"healthy"`
+	CheckedAt       time.Time        `json:"checked_at"`
+	Leader          uint64           `json:"leader,omitempty"`
+	RaftIndexSpread uint64           `json:"raft_index_spread"`
+	Alarms          []string         `json:"alarms,omitempty"`
+	Endpoints       []EndpointHealth `json:"endpoints"`
+	Problems        []string         `json:"problems,omitempty"`
+}
+
+// EndpointHealth holds the health of a single endpoint
+type EndpointHealth struct {
+	Endpoint  string `json:"endpoint"`
+	Healthy   bool   `json:"healthy"`
+	MemberID  uint64 `json:"member_id,omitempty"`
+	Leader    bool   `json:"leader"`
+	RaftIndex uint64 `json:"raft_index,omitempty"`
+	Revision  int64  `json:"revision,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// CheckHealth checks every endpoint, active alarms, leader agreement and the raft index
+// spread between members. The report is unhealthy if any endpoint is down, any alarm is
+// raised, members disagree on (or lack) a leader, or the spread exceeds maxRaftIndexSpread.
+func (c *Client) CheckHealth(ctx context.Context, maxRaftIndexSpread uint64) *HealthReport {
+	log.Debug(PKG_ETCD, "Checking cluster health")
+
+	report := &HealthReport{CheckedAt: time.Now().UTC()}
+	statuses := c.EndpointStatuses(ctx)
+
+	var minIndex, maxIndex uint64
+	leaders := make(map[uint64]bool)
+	for _, status := range statuses {
+		health := EndpointHealth{
+			Endpoint:  status.Endpoint,
+			Healthy:   status.Healthy(),
+			MemberID:  status.MemberID,
+			Leader:    status.IsLeader(),
+			RaftIndex: status.RaftIndex,
+			Revision:  status.Revision,
+		}
+
+		switch {
+		case status.Err != nil:
+			health.Error = status.Err.Error()
+			report.Problems = append(report.Problems, fmt.Sprintf("endpoint %s unreachable: %v", status.Endpoint, status.Err))
+		case len(status.Errors) > 0:
+			health.Error = fmt.Sprintf("%v", status.Errors)
+			report.Problems = append(report.Problems, fmt.Sprintf("endpoint %s reports errors: %v", status.Endpoint, status.Errors))
+		}
+		report.Endpoints = append(report.Endpoints, health)
+
+		if status.Err != nil {
+			continue
+		}
+
+		leaders[status.Leader] = true
+		if minIndex == 0 || status.RaftIndex < minIndex {
+			minIndex = status.RaftIndex
+		}
+		if status.RaftIndex > maxIndex {
+			maxIndex = status.RaftIndex
+		}
+	}
+
+	switch {
+	case len(leaders) == 0:
+		// Nothing answered, already reported per endpoint
+	case leaders[0]:
+		report.Problems = append(report.Problems, "one or more members have no leader")
+	case len(leaders) > 1:
+		report.Problems = append(report.Problems, fmt.Sprintf("members disagree on the leader (%d different leaders reported)", len(leaders)))
+	default:
+		for leader := range leaders {
+			report.Leader = leader
+		}
+	}
+
+	report.RaftIndexSpread = maxIndex - minIndex
+	if report.RaftIndexSpread > maxRaftIndexSpread {
+		report.Problems = append(report.Problems, fmt.Sprintf("raft index spread %d exceeds %d", report.RaftIndexSpread, maxRaftIndexSpread))
+	}
+
+	alarmCtx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+	alarms, err := c.client.AlarmList(alarmCtx)
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("failed to list alarms: %v", err))
+	} else {
+		for _, alarm := range alarms.Alarms {
+			report.Alarms = append(report.Alarms, fmt.Sprintf("%x:%s", alarm.MemberID, alarm.Alarm))
+		}
+		if len(report.Alarms) > 0 {
+			report.Problems = append(report.Problems, fmt.Sprintf("active alarms: %v", report.Alarms))
+		}
+	}
+
+	report.Healthy = len(report.Problems) == 0
+	return report
+}
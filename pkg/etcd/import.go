@@ -0,0 +1,246 @@
+package etcd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/thedataflows/go-lib-log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Import conflict modes, applied to keys that already exist in the target cluster
+const (
+	ImportSkipExisting   = "skip"
+	ImportOverwrite      = "overwrite"
+	ImportFailOnConflict = "fail"
+)
+
+// Import batch limits. etcd rejects transactions with more than 128 operations
+// or requests larger than 1.5 MiB by default.
+const (
+	defaultImportBatchSize = 100
+	// MaxImportBatchSize is the largest batch etcd accepts in one transaction by default
+	MaxImportBatchSize  = 128
+	maxImportBatchBytes = 1 << 20
+	maxImportAttempts   = 3
+)
+
+// ImportOptions controls how an export is replayed into a cluster
+type ImportOptions struct {
+	// Mode is one of ImportSkipExisting, ImportOverwrite or ImportFailOnConflict
+	Mode string
+	// RewriteFrom is replaced by RewriteTo in keys that start with it
+	RewriteFrom string
+	RewriteTo   string
+	// BatchSize is the maximum number of keys written per transaction
+	BatchSize int
+	// DryRun only reports what would be written
+	DryRun bool
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Records   int
+	Written   int
+	Skipped   int
+	Conflicts []string
+}
+
+// rewriteKey applies the prefix rewrite to a key
+func (o ImportOptions) rewriteKey(key []byte) []byte {
+	if o.RewriteFrom == "" || !bytes.HasPrefix(key, []byte(o.RewriteFrom)) {
+		return key
+	}
+	return append([]byte(o.RewriteTo), key[len(o.RewriteFrom):]...)
+}
+
+// Import replays an NDJSON export file into the cluster in batched transactions.
+// Keys are first checked against the cluster: in fail mode nothing is written if any
+// key already exists, and a dry run stops after the check. Writes are guarded so keys
+// created concurrently are never overwritten outside overwrite mode.
+// Leases are not carried over since lease IDs are only valid in the source cluster.
+func (c *Client) Import(ctx context.Context, path string, opts ImportOptions) (*ImportResult, error) {
+	switch opts.Mode {
+	case ImportSkipExisting, ImportOverwrite, ImportFailOnConflict:
+	default:
+		return nil, fmt.Errorf("unknown import mode: %s", opts.Mode)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultImportBatchSize
+	}
+	if opts.BatchSize > MaxImportBatchSize {
+		return nil, fmt.Errorf("batch size %d is over the %d operations etcd allows per transaction", opts.BatchSize, MaxImportBatchSize)
+	}
+
+	// Check pass: count what would be written, skipped or conflict
+	result := &ImportResult{}
+	err := readImportBatches(path, opts, func(batch []KeyRecord) error {
+		existing, err := c.existingKeys(ctx, batch)
+		if err != nil {
+			return err
+		}
+
+		result.Records += len(batch)
+		for _, record := range batch {
+			switch {
+			case !existing[string(record.KeyBytes())] || opts.Mode == ImportOverwrite:
+				result.Written++
+			case opts.Mode == ImportSkipExisting:
+				result.Skipped++
+			default:
+				result.Conflicts = append(result.Conflicts, string(record.KeyBytes()))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Int("records", result.Records).Int("written", result.Written).Int("skipped", result.Skipped).Int("conflicts", len(result.Conflicts)).Msg("Import checked")
+
+	if opts.DryRun {
+		return result, nil
+	}
+	if len(result.Conflicts) > 0 {
+		return result, fmt.Errorf("%d keys already exist in the cluster, nothing imported", len(result.Conflicts))
+	}
+
+	// Apply pass
+	result.Written, result.Skipped = 0, 0
+	err = readImportBatches(path, opts, func(batch []KeyRecord) error {
+		written, err := c.importBatch(ctx, batch, opts.Mode)
+		if err != nil {
+			return err
+		}
+		result.Written += written
+		result.Skipped += len(batch) - written
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Int("written", result.Written).Int("skipped", result.Skipped).Msg("Import completed")
+	return result, nil
+}
+
+// readImportBatches decodes export records with keys rewritten and passes them to fn
+// in batches bounded by count and size
+func readImportBatches(path string, opts ImportOptions, fn func([]KeyRecord) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open export: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	var batch []KeyRecord
+	var batchBytes int
+	for line := 1; ; line++ {
+		var record KeyRecord
+		if err := decoder.Decode(&record); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to decode export record %d: %w", line, err)
+		}
+
+		key := opts.rewriteKey(record.KeyBytes())
+		if len(key) == 0 {
+			return fmt.Errorf("export record %d has no key", line)
+		}
+		record.Key, record.KeyBase64 = string(key), nil
+
+		size := len(key) + len(record.Value)
+		if len(batch) > 0 && (len(batch) >= opts.BatchSize || batchBytes+size > maxImportBatchBytes) {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch, batchBytes = nil, 0
+		}
+		batch = append(batch, record)
+		batchBytes += size
+	}
+
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// existingKeys returns the keys of the batch that exist in the cluster
+func (c *Client) existingKeys(ctx context.Context, batch []KeyRecord) (map[string]bool, error) {
+	ops := make([]clientv3.Op, 0, len(batch))
+	for _, record := range batch {
+		ops = append(ops, clientv3.OpGet(record.Key, clientv3.WithCountOnly()))
+	}
+
+	txnCtx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+	resp, err := c.client.Txn(txnCtx).Then(ops...).Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing keys: %w", err)
+	}
+
+	existing := make(map[string]bool)
+	for i, r := range resp.Responses {
+		if r.GetResponseRange().GetCount() > 0 {
+			existing[batch[i].Key] = true
+		}
+	}
+	return existing, nil
+}
+
+// importBatch writes a batch in a single transaction and returns the number of keys written.
+// Outside overwrite mode only missing keys are written, guarded on them still being missing;
+// the batch is re-evaluated if another client created one of them in the meantime.
+func (c *Client) importBatch(ctx context.Context, batch []KeyRecord, mode string) (int, error) {
+	for attempt := 1; attempt <= maxImportAttempts; attempt++ {
+		toWrite := batch
+		if mode != ImportOverwrite {
+			existing, err := c.existingKeys(ctx, batch)
+			if err != nil {
+				return 0, err
+			}
+			toWrite = nil
+			for _, record := range batch {
+				if !existing[record.Key] {
+					toWrite = append(toWrite, record)
+				} else if mode == ImportFailOnConflict {
+					return 0, fmt.Errorf("key %s already exists in the cluster", record.Key)
+				}
+			}
+		}
+		if len(toWrite) == 0 {
+			return 0, nil
+		}
+
+		var conds []clientv3.Cmp
+		puts := make([]clientv3.Op, 0, len(toWrite))
+		for _, record := range toWrite {
+			if mode != ImportOverwrite {
+				conds = append(conds, clientv3.Compare(clientv3.CreateRevision(record.Key), "=", 0))
+			}
+			puts = append(puts, clientv3.OpPut(record.Key, string(record.Value)))
+		}
+
+		txnCtx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+		resp, err := c.client.Txn(txnCtx).If(conds...).Then(puts...).Commit()
+		cancel()
+		if err != nil {
+			return 0, fmt.Errorf("failed to write batch: %w", err)
+		}
+		if resp.Succeeded {
+			return len(toWrite), nil
+		}
+		log.Debugf(PKG_ETCD, "Keys were created concurrently, retrying batch (attempt %d)", attempt)
+	}
+
+	return 0, fmt.Errorf("keys kept being created concurrently, giving up after %d attempts", maxImportAttempts)
+}
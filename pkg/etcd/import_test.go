@@ -0,0 +1,118 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+)
+
+// writeExport writes export records for the given keys to a temp file
+func writeExport(t *testing.T, keys map[string]string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "export"+ExportExt)
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for key, value := range keys {
+		require.NoError(t, encoder.Encode(KeyRecord{Key: key, Value: []byte(value), ModRevision: 1, Version: 1}))
+	}
+	return path
+}
+
+func TestClient_Import(tMain *testing.T) {
+	export := map[string]string{
+		"/app-a/1": "new-1",
+		"/app-a/2": "new-2",
+		"/app-a/3": "new-3",
+	}
+	existing := map[string]string{"/app-a/2": "old-2"}
+
+	tests := []struct {
+		name        string
+		opts        ImportOptions
+		expectError bool
+		expected    map[string]string
+		written     int
+		skipped     int
+		conflicts   int
+	}{
+		{
+			name:     "skip existing",
+			opts:     ImportOptions{Mode: ImportSkipExisting, BatchSize: 2},
+			expected: map[string]string{"/app-a/1": "new-1", "/app-a/2": "old-2", "/app-a/3": "new-3"},
+			written:  2,
+			skipped:  1,
+		},
+		{
+			name:     "overwrite",
+			opts:     ImportOptions{Mode: ImportOverwrite},
+			expected: map[string]string{"/app-a/1": "new-1", "/app-a/2": "new-2", "/app-a/3": "new-3"},
+			written:  3,
+		},
+		{
+			name:        "fail on conflict writes nothing",
+			opts:        ImportOptions{Mode: ImportFailOnConflict, BatchSize: 1},
+			expectError: true,
+			expected:    existing,
+			written:     2,
+			conflicts:   1,
+		},
+		{
+			name:     "dry run",
+			opts:     ImportOptions{Mode: ImportSkipExisting, DryRun: true},
+			expected: existing,
+			written:  2,
+			skipped:  1,
+		},
+		{
+			name: "rewrite prefix",
+			opts: ImportOptions{Mode: ImportFailOnConflict, RewriteFrom: "/app-a/", RewriteTo: "/app-a-restored/"},
+			expected: map[string]string{
+				"/app-a/2":          "old-2",
+				"/app-a-restored/1": "new-1",
+				"/app-a-restored/2": "new-2",
+				"/app-a-restored/3": "new-3",
+			},
+			written: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		tMain.Run(tt.name, func(t *testing.T) {
+			srv := etcdtest.Start(t, etcdtest.Config{})
+			srv.PutKeys(t, existing)
+
+			client, err := NewClient(appconfig.EtcdConfig{Endpoints: []string{srv.Endpoint}})
+			require.NoError(t, err)
+			defer client.Close()
+
+			result, err := client.Import(context.Background(), writeExport(t, export), tt.opts)
+			if tt.expectError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, len(export), result.Records)
+			assert.Equal(t, tt.written, result.Written)
+			assert.Equal(t, tt.skipped, result.Skipped)
+			assert.Len(t, result.Conflicts, tt.conflicts)
+			assert.Equal(t, tt.expected, srv.GetKeys(t, "/"))
+		})
+	}
+}
+
+func TestClient_ImportUnknownMode(t *testing.T) {
+	client := &Client{}
+	_, err := client.Import(context.Background(), "unused", ImportOptions{Mode: "merge"})
+	assert.ErrorContains(t, err, "unknown import mode")
+}
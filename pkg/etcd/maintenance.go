@@ -0,0 +1,52 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/thedataflows/go-lib-log"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Compact compacts the keyspace up to the current revision minus retain.
+// Returns the revision compacted to, or 0 if there was nothing to compact.
+func (c *Client) Compact(ctx context.Context, retain int64) (int64, error) {
+	resp, err := c.client.Get(ctx, "/", clientv3.WithCountOnly())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get current revision: %w", err)
+	}
+
+	current := resp.Header.Revision
+	target := current - retain
+	if target <= 0 {
+		log.Debugf(PKG_ETCD, "Nothing to compact: current revision %d, retaining %d", current, retain)
+		return 0, nil
+	}
+
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Int64("current_revision", current).Int64("target_revision", target).Msg("Compacting keyspace")
+	if _, err := c.client.Compact(ctx, target, clientv3.WithCompactPhysical()); err != nil {
+		if errors.Is(err, rpctypes.ErrCompacted) {
+			log.Debugf(PKG_ETCD, "Revision %d is already compacted", target)
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to compact to revision %d: %w", target, err)
+	}
+
+	return target, nil
+}
+
+// Defragment defragments the backend database of a single member
+func (c *Client) Defragment(ctx context.Context, endpoint string) error {
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Str("endpoint", endpoint).Msg("Defragmenting member")
+
+	start := time.Now()
+	if _, err := c.client.Defragment(ctx, endpoint); err != nil {
+		return fmt.Errorf("failed to defragment %s: %w", endpoint, err)
+	}
+
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Str("endpoint", endpoint).Str("duration", time.Since(start).String()).Msg("Defragmentation completed")
+	return nil
+}
@@ -0,0 +1,103 @@
+package etcd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultClusterToken is the initial cluster token used when restoring without one
+const DefaultClusterToken = "etcd-cluster"
+
+// RestoreMember is a member of a restored cluster
+type RestoreMember struct {
+	Name       string
+	PeerURLs   []string
+	ClientURLs []string
+}
+
+// MemberLayout describes how a restored member is laid out on disk, matching the flags
+// the member is started with
+type MemberLayout struct {
+	// WALDir is the WAL directory (etcd --wal-dir), empty keeps the WAL under the data directory
+	WALDir string
+	// SnapshotCount is the etcd --snapshot-count of the member, 0 keeps the etcd default
+	SnapshotCount uint64
+	// Owner owns the restored directories and files, nil keeps the restoring user
+	Owner *Owner
+	// DirMode is the mode of the restored directories, 0 keeps the mode etcd creates them with
+	DirMode os.FileMode
+}
+
+// Owner is the owner of restored files, -1 keeps the uid or gid unchanged
+type Owner struct {
+	UID int
+	GID int
+}
+
+// ParseRestoreMember parses a member in the form name=peerURL[,peerURL...]
+func ParseRestoreMember(s string) (RestoreMember, error) {
+	name, urls, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return RestoreMember{}, fmt.Errorf("invalid member %q, expected name=peerURL[,peerURL...]", s)
+	}
+
+	member := RestoreMember{Name: name}
+	for _, url := range strings.Split(urls, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			member.PeerURLs = append(member.PeerURLs, url)
+		}
+	}
+	if len(member.PeerURLs) == 0 {
+		return RestoreMember{}, fmt.Errorf("member %q has no peer URLs", name)
+	}
+	return member, nil
+}
+
+// InitialCluster builds the --initial-cluster value for a list of members,
+// with one name=url entry per peer URL
+func InitialCluster(members []RestoreMember) (string, error) {
+	seen := make(map[string]bool, len(members))
+	var entries []string
+	for _, member := range members {
+		if seen[member.Name] {
+			return "", fmt.Errorf("duplicate member name %q", member.Name)
+		}
+		seen[member.Name] = true
+		if len(member.PeerURLs) == 0 {
+			return "", fmt.Errorf("member %q has no peer URLs", member.Name)
+		}
+		for _, url := range member.PeerURLs {
+			entries = append(entries, member.Name+"="+url)
+		}
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("no members to restore")
+	}
+	return strings.Join(entries, ","), nil
+}
+
+// EtcdFlags returns the etcd flags that start a member from its restored data directory.
+// Listen URLs depend on the host and are left to the caller.
+func (m RestoreMember) EtcdFlags(dataDir, initialCluster, token string, layout MemberLayout) []string {
+	flags := []string{
+		"--name=" + m.Name,
+		"--data-dir=" + dataDir,
+		"--initial-advertise-peer-urls=" + strings.Join(m.PeerURLs, ","),
+		"--initial-cluster=" + initialCluster,
+		"--initial-cluster-token=" + token,
+		"--initial-cluster-state=new",
+	}
+	if layout.WALDir != "" {
+		flags = append(flags, "--wal-dir="+layout.WALDir)
+	}
+	if layout.SnapshotCount > 0 {
+		flags = append(flags, "--snapshot-count="+strconv.FormatUint(layout.SnapshotCount, 10))
+	}
+	if len(m.ClientURLs) > 0 {
+		flags = append(flags, "--advertise-client-urls="+strings.Join(m.ClientURLs, ","))
+	}
+	return flags
+}
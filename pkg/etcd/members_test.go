@@ -0,0 +1,59 @@
+package etcd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRestoreMember(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected RestoreMember
+		wantErr  bool
+	}{
+		{value: "a=http://10.0.0.1:2380", expected: RestoreMember{Name: "a", PeerURLs: []string{"http://10.0.0.1:2380"}}},
+		{value: "b=http://10.0.0.2:2380, https://b.example:2380", expected: RestoreMember{Name: "b", PeerURLs: []string{"http://10.0.0.2:2380", "https://b.example:2380"}}},
+		{value: "http://10.0.0.1:2380", wantErr: true},
+		{value: "=http://10.0.0.1:2380", wantErr: true},
+		{value: "a=", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		member, err := ParseRestoreMember(tt.value)
+		if tt.wantErr {
+			assert.Error(t, err, tt.value)
+			continue
+		}
+		require.NoError(t, err, tt.value)
+		assert.Equal(t, tt.expected, member)
+	}
+}
+
+func TestInitialCluster(t *testing.T) {
+	members := []RestoreMember{
+		{Name: "a", PeerURLs: []string{"http://10.0.0.1:2380", "http://a.example:2380"}},
+		{Name: "b", PeerURLs: []string{"http://10.0.0.2:2380"}},
+	}
+	initialCluster, err := InitialCluster(members)
+	require.NoError(t, err)
+	assert.Equal(t, "a=http://10.0.0.1:2380,a=http://a.example:2380,b=http://10.0.0.2:2380", initialCluster)
+
+	_, err = InitialCluster(append(members, RestoreMember{Name: "a", PeerURLs: []string{"http://10.0.0.3:2380"}}))
+	assert.Error(t, err, "duplicate name")
+
+	_, err = InitialCluster(nil)
+	assert.Error(t, err, "no members")
+
+	flags := members[1].EtcdFlags("/var/lib/etcd/b", initialCluster, "restored", MemberLayout{})
+	assert.Contains(t, flags, "--initial-cluster-token=restored")
+	assert.Contains(t, flags, "--initial-advertise-peer-urls=http://10.0.0.2:2380")
+	assert.Contains(t, flags, "--data-dir=/var/lib/etcd/b")
+	assert.NotContains(t, strings.Join(flags, " "), "--wal-dir")
+
+	flags = members[1].EtcdFlags("/var/lib/etcd/b", initialCluster, "restored", MemberLayout{WALDir: "/wal/b", SnapshotCount: 50000})
+	assert.Contains(t, flags, "--wal-dir=/wal/b")
+	assert.Contains(t, flags, "--snapshot-count=50000")
+}
@@ -0,0 +1,288 @@
+package etcd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// tlsVersions maps the accepted minimum TLS version names to their values
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsEnabled reports whether the configuration asks for a TLS connection
+func tlsEnabled(cfg appconfig.EtcdConfig) bool {
+	if cfg.CertFile != "" || cfg.KeyFile != "" || cfg.CaFile != "" || cfg.InsecureSkipVerify || cfg.ServerName != "" {
+		return true
+	}
+	for _, endpoint := range cfg.Endpoints {
+		if strings.HasPrefix(endpoint, "https://") {
+			return true
+		}
+	}
+	return false
+}
+
+// buildTLSConfig builds the client TLS configuration, or returns nil if TLS is not configured.
+// Without a CA file the server certificate is verified against the system root pool;
+// verification is only skipped when InsecureSkipVerify is explicitly set.
+func buildTLSConfig(cfg appconfig.EtcdConfig) (*tls.Config, error) {
+	if !tlsEnabled(cfg) {
+		log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("No TLS configuration provided")
+		return nil, nil
+	}
+
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("Setting up TLS configuration")
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	minVersion := cfg.TLSMinVersion
+	if minVersion == "" {
+		minVersion = "1.2"
+	}
+	version, ok := tlsVersions[minVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported minimum TLS version: %s", minVersion)
+	}
+	tlsConfig.MinVersion = version
+
+	if len(cfg.TLSCipherSuites) > 0 {
+		suites, err := parseCipherSuites(cfg.TLSCipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.CipherSuites = suites
+	}
+
+	// Load client certificate, it is re-read from disk whenever the files change
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, fmt.Errorf("both client certificate and key files are required")
+		}
+
+		log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Str("cert_file", cfg.CertFile).Str("key_file", cfg.KeyFile).Msg("Loading client certificate")
+		reloader, err := newCertReloader(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = reloader.GetClientCertificate
+		log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("Client certificate loaded successfully")
+	}
+
+	// RootCAs is fixed once the connection is set up, so the server certificate is verified
+	// in VerifyConnection against the CA file, re-read from disk whenever it changes
+	if cfg.CaFile != "" {
+		log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Str("ca_file", cfg.CaFile).Msg("Loading CA certificate")
+		reloader, err := newCAReloader(cfg.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		if !cfg.InsecureSkipVerify {
+			tlsConfig.InsecureSkipVerify = true
+			tlsConfig.VerifyConnection = reloader.VerifyConnection
+		}
+		log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("CA certificate loaded")
+	} else {
+		log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Msg("No CA certificate provided, using system root CAs")
+	}
+
+	if cfg.InsecureSkipVerify {
+		log.Logger.Warn().Str(log.KEY_PKG, PKG_ETCD).Msg("TLS server certificate verification is disabled")
+	}
+
+	return tlsConfig, nil
+}
+
+// parseCipherSuites converts cipher suite names to their IDs
+func parseCipherSuites(names []string) ([]uint16, error) {
+	available := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		available[suite.Name] = suite.ID
+	}
+
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := available[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure TLS cipher suite: %s", name)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+// certReloader serves a client certificate and reloads it when the files on disk change
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// newCertReloader loads the key pair once so configuration errors surface immediately
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate
+func (r *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.load()
+}
+
+// load returns the cached certificate, re-reading it if either file changed
+func (r *certReloader) load() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			// Keep serving the last good certificate while files are being replaced
+			log.Logger.Warn().Str(log.KEY_PKG, PKG_ETCD).Err(err).Msg("Failed to stat client certificate, using cached certificate")
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+
+	if r.cert != nil && !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			log.Logger.Warn().Str(log.KEY_PKG, PKG_ETCD).Err(err).Msg("Failed to reload client certificate, using cached certificate")
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+
+	if r.cert != nil {
+		log.Logger.Info().Str(log.KEY_PKG, PKG_ETCD).Str("cert_file", r.certFile).Msg("Client certificate reloaded")
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return r.cert, nil
+}
+
+// caReloader verifies server certificates against a CA file and reloads it when the file
+// on disk changes
+type caReloader struct {
+	caFile string
+
+	mu      sync.Mutex
+	pool    *x509.CertPool
+	modTime time.Time
+}
+
+// newCAReloader loads the CA file once so configuration errors surface immediately
+func newCAReloader(caFile string) (*caReloader, error) {
+	r := &caReloader{caFile: caFile}
+	if _, err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// VerifyConnection implements tls.Config.VerifyConnection, verifying the server
+// certificate chain and name like the standard verification does with RootCAs
+func (r *caReloader) VerifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("server presented no certificate")
+	}
+	pool, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	opts := x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         pool,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err = cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// load returns the cached CA pool, re-reading it if the file changed
+func (r *caReloader) load() (*x509.CertPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := latestModTime(r.caFile)
+	if err != nil {
+		if r.pool != nil {
+			log.Logger.Warn().Str(log.KEY_PKG, PKG_ETCD).Err(err).Msg("Failed to stat CA certificate, using cached CA")
+			return r.pool, nil
+		}
+		return nil, fmt.Errorf("failed to read CA certificate file: %w", err)
+	}
+
+	if r.pool != nil && !modTime.After(r.modTime) {
+		return r.pool, nil
+	}
+
+	pool, err := readCAPool(r.caFile)
+	if err != nil {
+		if r.pool != nil {
+			log.Logger.Warn().Str(log.KEY_PKG, PKG_ETCD).Err(err).Msg("Failed to reload CA certificate, using cached CA")
+			return r.pool, nil
+		}
+		return nil, err
+	}
+
+	if r.pool != nil {
+		log.Logger.Info().Str(log.KEY_PKG, PKG_ETCD).Str("ca_file", r.caFile).Msg("CA certificate reloaded")
+	}
+	r.pool = pool
+	r.modTime = modTime
+	return r.pool, nil
+}
+
+// readCAPool reads a PEM file of CA certificates into a pool
+func readCAPool(caFile string) (*x509.CertPool, error) {
+	caCert, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("failed to parse CA certificate")
+	}
+	return pool, nil
+}
+
+// latestModTime returns the most recent modification time of the given files
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,168 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/thedataflows/go-lib-log"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Watch event types
+const (
+	EventPut    = "put"
+	EventDelete = "delete"
+)
+
+// ErrWatchCompacted is returned when the watch start revision has been compacted away
+var ErrWatchCompacted = errors.New("watch start revision has been compacted")
+
+// WatchEvent is a single change recorded from a watch, one JSON object per line.
+// For deletes, ModRevision is the revision of the delete and Value is empty.
+type WatchEvent struct {
+	Type string `json:"type"`
+	KeyRecord
+	ObservedAt time.Time `json:"observed_at"`
+}
+
+// NewWatchEvent converts a watch event into a record
+func NewWatchEvent(event *clientv3.Event, observedAt time.Time) WatchEvent {
+	eventType := EventPut
+	if event.Type == mvccpb.DELETE {
+		eventType = EventDelete
+	}
+	return WatchEvent{
+		Type:       eventType,
+		KeyRecord:  NewKeyRecord(event.Kv),
+		ObservedAt: observedAt,
+	}
+}
+
+// Watch streams every change to the keyspace starting at fromRevision. fn is called with
+// each batch of events and the revision up to which all changes have been delivered,
+// and with no events every tick so callers can act on time. Watch runs until ctx is
+// done or fn returns an error; it returns ErrWatchCompacted if fromRevision is no
+// longer available.
+func (c *Client) Watch(ctx context.Context, fromRevision int64, tick time.Duration, fn func(events []WatchEvent, revision int64) error) error {
+	watchCtx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+
+	log.Logger.Debug().Str(log.KEY_PKG, PKG_ETCD).Int64("from_revision", fromRevision).Msg("Starting watch")
+	watchChan := c.client.Watch(watchCtx, "", clientv3.WithPrefix(), clientv3.WithRev(fromRevision), clientv3.WithProgressNotify())
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	revision := fromRevision - 1
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-ticker.C:
+			if err := fn(nil, revision); err != nil {
+				return err
+			}
+
+		case resp, ok := <-watchChan:
+			if !ok {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return fmt.Errorf("watch closed unexpectedly")
+			}
+			if resp.CompactRevision > 0 {
+				return fmt.Errorf("%w: revision %d, oldest available is %d", ErrWatchCompacted, fromRevision, resp.CompactRevision)
+			}
+			if err := resp.Err(); err != nil {
+				return fmt.Errorf("watch failed: %w", err)
+			}
+
+			// Progress notifications guarantee every change up to the header revision
+			// was delivered. Event responses may lag behind the header while catching up.
+			if resp.IsProgressNotify() {
+				revision = max(revision, resp.Header.Revision)
+				continue
+			}
+
+			now := time.Now().UTC()
+			events := make([]WatchEvent, 0, len(resp.Events))
+			for _, event := range resp.Events {
+				events = append(events, NewWatchEvent(event, now))
+			}
+			if len(events) > 0 {
+				revision = max(revision, events[len(events)-1].ModRevision)
+			}
+
+			if err := fn(events, revision); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ApplyEvents replays watch events in order, one transaction per source revision.
+// Replayed on top of a snapshot taken at the revision before the first event, the
+// target ends up with the same revisions as the source.
+func (c *Client) ApplyEvents(ctx context.Context, events []WatchEvent) error {
+	for start := 0; start < len(events); {
+		end := start + 1
+		for end < len(events) && events[end].ModRevision == events[start].ModRevision {
+			end++
+		}
+
+		ops := make([]clientv3.Op, 0, end-start)
+		for _, event := range events[start:end] {
+			key := string(event.KeyBytes())
+			switch event.Type {
+			case EventPut:
+				ops = append(ops, clientv3.OpPut(key, string(event.Value)))
+			case EventDelete:
+				ops = append(ops, clientv3.OpDelete(key))
+			default:
+				return fmt.Errorf("unknown event type %q at revision %d", event.Type, event.ModRevision)
+			}
+		}
+
+		txnCtx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+		_, err := c.client.Txn(txnCtx).Then(ops...).Commit()
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to apply changes of revision %d: %w", events[start].ModRevision, err)
+		}
+
+		start = end
+	}
+	return nil
+}
+
+// Revision returns the current revision of the keyspace
+func (c *Client) Revision(ctx context.Context) (int64, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	resp, err := c.client.Get(reqCtx, "/", clientv3.WithCountOnly())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get current revision: %w", err)
+	}
+	return resp.Header.Revision, nil
+}
+
+// Count returns the number of keys equal to key, or starting with key when prefix is set
+func (c *Client) Count(ctx context.Context, key string, prefix bool) (int64, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	opts := []clientv3.OpOption{clientv3.WithCountOnly()}
+	if prefix {
+		opts = append(opts, clientv3.WithPrefix())
+	}
+	resp, err := c.client.Get(reqCtx, key, opts...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count keys %s: %w", key, err)
+	}
+	return resp.Count, nil
+}
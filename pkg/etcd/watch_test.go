@@ -0,0 +1,94 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestClient_WatchAndApplyEvents(t *testing.T) {
+	source := etcdtest.Start(t, etcdtest.Config{})
+	target := etcdtest.Start(t, etcdtest.Config{})
+
+	sourceClient, err := NewClient(appconfig.EtcdConfig{Endpoints: []string{source.Endpoint}})
+	require.NoError(t, err)
+	defer sourceClient.Close()
+	targetClient, err := NewClient(appconfig.EtcdConfig{Endpoints: []string{target.Endpoint}})
+	require.NoError(t, err)
+	defer targetClient.Close()
+
+	ctx := context.Background()
+	startRevision, err := sourceClient.Revision(ctx)
+	require.NoError(t, err)
+
+	raw := source.Client(t)
+	_, err = raw.Put(ctx, "/a", "1")
+	require.NoError(t, err)
+	_, err = raw.Put(ctx, "/b", "2")
+	require.NoError(t, err)
+	_, err = raw.Delete(ctx, "/a")
+	require.NoError(t, err)
+	_, err = raw.Txn(ctx).Then(
+		clientv3.OpPut("/c", "3"),
+		clientv3.OpPut("/d", "4"),
+	).Commit()
+	require.NoError(t, err)
+
+	endRevision, err := sourceClient.Revision(ctx)
+	require.NoError(t, err)
+
+	// Collect every change until the end revision is reached
+	var events []WatchEvent
+	errDone := errors.New("done")
+	watchCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err = sourceClient.Watch(watchCtx, startRevision+1, time.Second, func(batch []WatchEvent, revision int64) error {
+		events = append(events, batch...)
+		if revision >= endRevision {
+			return errDone
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errDone)
+	require.Len(t, events, 5)
+	assert.Equal(t, EventDelete, events[2].Type)
+	assert.Equal(t, events[3].ModRevision, events[4].ModRevision)
+
+	// Replayed on a target at the same revision, the revisions line up
+	targetRevision, err := targetClient.Revision(ctx)
+	require.NoError(t, err)
+	require.Equal(t, startRevision, targetRevision)
+
+	require.NoError(t, targetClient.ApplyEvents(ctx, events))
+	assert.Equal(t, source.GetKeys(t, "/"), target.GetKeys(t, "/"))
+
+	targetRevision, err = targetClient.Revision(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, endRevision, targetRevision)
+}
+
+func TestClient_WatchCompacted(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.Config{})
+	for range 5 {
+		srv.PutKeys(t, map[string]string{"/counter": "x"})
+	}
+
+	client, err := NewClient(appconfig.EtcdConfig{Endpoints: []string{srv.Endpoint}})
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Compact(context.Background(), 1)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = client.Watch(ctx, 2, time.Second, func([]WatchEvent, int64) error { return nil })
+	assert.ErrorIs(t, err, ErrWatchCompacted)
+}
@@ -0,0 +1,98 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+)
+
+// Suffix is appended to a snapshot file name to form its manifest file name
+const Suffix = ".manifest.json"
+
+// Manifest holds metadata recorded alongside a snapshot
+type Manifest struct {
+	Snapshot    string             `json:"snapshot"`
+	CreatedAt   time.Time          `json:"created_at"`
+	Endpoint    string             `json:"endpoint"`
+	ClusterID   uint64             `json:"cluster_id,omitempty"`
+	MemberID    uint64             `json:"member_id,omitempty"`
+	Revision    int64              `json:"revision"`
+	TotalKeys   int                `json:"total_keys"`
+	DBHash      uint32             `json:"db_hash"`
+	RaftIndex   uint64             `json:"raft_index"`
+	DBSize      int64              `json:"db_size"`
+	Size        int64              `json:"size"`
+	SHA256      string             `json:"sha256"`
+	Compression string             `json:"compression"`
+	Health      *etcd.HealthReport `json:"health,omitempty"`
+	// WriteRate is the average number of revisions per second before the snapshot
+	WriteRate float64 `json:"write_rate,omitempty"`
+}
+
+// Name returns the manifest file name (or S3 key) for a snapshot file name (or S3 key)
+func Name(snapshot string) string {
+	return snapshot + Suffix
+}
+
+// IsManifest reports whether a file name is a snapshot manifest
+func IsManifest(filename string) bool {
+	return strings.HasSuffix(filename, Suffix)
+}
+
+// Load reads a manifest from a file
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	m, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest '%s': %w", path, err)
+	}
+	return m, nil
+}
+
+// Parse decodes a manifest, e.g. one read from S3
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Save writes the manifest to a file
+func (m *Manifest) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// FileSHA256 returns the hex encoded SHA-256 digest of a file
+func FileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
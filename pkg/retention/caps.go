@@ -0,0 +1,62 @@
+package retention
+
+import (
+	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// Usage is the number and total size of a set of snapshots
+type Usage struct {
+	Count int   `json:"count"`
+	Bytes int64 `json:"bytes"`
+}
+
+// Exceeds reports whether the usage is over the caps of the policy, 0 caps are unlimited
+func (u Usage) Exceeds(policy appconfig.RetentionPolicy) bool {
+	return (policy.MaxCount > 0 && u.Count > policy.MaxCount) ||
+		(policy.MaxTotalBytes > 0 && u.Bytes > policy.MaxTotalBytes)
+}
+
+// KeptUsage returns the usage of the snapshots kept by a retention decision
+func KeptUsage(snapshots []SnapshotFile, toKeep map[string]bool) Usage {
+	var usage Usage
+	for _, snapshot := range snapshots {
+		if toKeep[snapshot.Name] {
+			usage.Count++
+			usage.Bytes += snapshot.Size
+		}
+	}
+	return usage
+}
+
+// applyCaps drops the oldest kept snapshots stored in the tier until the kept ones it
+// stores fit MaxCount and MaxTotalBytes; a nil stored means the tier stores all snapshots.
+// The KeepLast newest snapshots are never dropped, a cap they exceed on their own is only
+// reported. Snapshots must be sorted newest first.
+func applyCaps(snapshots []SnapshotFile, stored, toKeep map[string]bool, policy appconfig.RetentionPolicy, tier string) {
+	isStored := func(name string) bool { return stored == nil || stored[name] }
+
+	var usage Usage
+	for _, snapshot := range snapshots {
+		if toKeep[snapshot.Name] && isStored(snapshot.Name) {
+			usage.Count++
+			usage.Bytes += snapshot.Size
+		}
+	}
+
+	for i := len(snapshots) - 1; i >= policy.KeepLast && usage.Exceeds(policy); i-- {
+		snapshot := snapshots[i]
+		if !toKeep[snapshot.Name] || !isStored(snapshot.Name) {
+			continue
+		}
+		delete(toKeep, snapshot.Name)
+		usage.Count--
+		usage.Bytes -= snapshot.Size
+		log.Infof(PKG_RETENTION, "Snapshot %s: deleted to fit the %s caps", snapshot.Name, tier)
+	}
+
+	if usage.Exceeds(policy) {
+		log.Warnf(PKG_RETENTION, "The %d %s snapshots protected by KeepLast use %d bytes, over the caps of %d snapshots and %d bytes",
+			usage.Count, tier, usage.Bytes, policy.MaxCount, policy.MaxTotalBytes)
+	}
+}
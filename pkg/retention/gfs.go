@@ -0,0 +1,72 @@
+package retention
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// Retention modes
+const (
+	// ModeGFS keeps the newest snapshot of each of the last N hours, days, weeks, months
+	// and years that have snapshots (grandfather-father-son), unioned with KeepLast
+	ModeGFS = "gfs"
+	// ModeAge keeps snapshots younger than every configured age window
+	ModeAge = "age"
+)
+
+// gfsBucket is a GFS period: how many of them to keep and the key of the period a time falls in
+type gfsBucket struct {
+	policy string
+	keep   int
+	key    func(t time.Time) string
+}
+
+// keepGFS keeps the KeepLast newest snapshots and, for every period kind, the newest
+// snapshot of each of the last N periods that have snapshots, like restic and borg do.
+// Periods are calendar periods in loc. Snapshots must be sorted newest first.
+func keepGFS(snapshots []SnapshotFile, policy appconfig.RetentionPolicy, loc *time.Location) map[string]bool {
+	toKeep := make(map[string]bool)
+
+	for i, snapshot := range snapshots {
+		if i >= policy.KeepLast {
+			break
+		}
+		toKeep[snapshot.Name] = true
+		log.Debugf(PKG_RETENTION, "Snapshot %s: kept by KeepLast policy (rank %d)", snapshot.Name, i+1)
+	}
+
+	buckets := []gfsBucket{
+		// The offset tells apart the hour repeated when DST ends
+		{policy: "KeepLastHours", keep: policy.KeepLastHours, key: func(t time.Time) string { return t.Format("2006-01-02 15 -0700") }},
+		{policy: "KeepLastDays", keep: policy.KeepLastDays, key: func(t time.Time) string { return t.Format("2006-01-02") }},
+		{policy: "KeepLastWeeks", keep: policy.KeepLastWeeks, key: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{policy: "KeepLastMonths", keep: policy.KeepLastMonths, key: func(t time.Time) string { return t.Format("2006-01") }},
+		{policy: "KeepLastYears", keep: policy.KeepLastYears, key: func(t time.Time) string { return t.Format("2006") }},
+	}
+
+	for _, bucket := range buckets {
+		kept, lastKey := 0, ""
+		for _, snapshot := range snapshots {
+			if kept >= bucket.keep {
+				break
+			}
+			// The newest snapshot of a period is the first one seen with its key
+			key := bucket.key(snapshot.Created().In(loc))
+			if key == lastKey {
+				continue
+			}
+			lastKey = key
+			kept++
+			toKeep[snapshot.Name] = true
+			log.Debugf(PKG_RETENTION, "Snapshot %s: kept by %s policy (period %s)", snapshot.Name, bucket.policy, key)
+		}
+	}
+
+	return toKeep
+}
@@ -2,6 +2,7 @@ package retention
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,33 +13,79 @@ import (
 
 	"github.com/thedataflows/etcd2s3/pkg/appconfig"
 	"github.com/thedataflows/etcd2s3/pkg/compression"
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	"github.com/thedataflows/etcd2s3/pkg/manifest"
 	"github.com/thedataflows/etcd2s3/pkg/s3"
 	log "github.com/thedataflows/go-lib-log"
 )
 
 const PKG_RETENTION = "retention"
 
+// DefaultNameLayout is the time layout of the names given to snapshots by default, in UTC
+const DefaultNameLayout = "etcd-snapshot-20060102-150405Z"
+
+// legacyNameLayout is the time layout of the names older versions gave snapshots, in local time
+const legacyNameLayout = "etcd-snapshot-20060102-150405"
+
 // Manager handles retention policies for snapshots
 type Manager struct {
-	policy appconfig.RetentionPolicy
+	local  appconfig.RetentionPolicy
+	remote appconfig.RetentionPolicy
+	now    func() time.Time
+	// nameLayout dates snapshots by the time stamp at the start of their names
+	nameLayout string
 }
 
 // SnapshotFile represents a snapshot file with metadata
 type SnapshotFile struct {
-	Name     string
-	Path     string
-	Size     int64
-	ModTime  time.Time
-	IsRemote bool
+	Name    string
+	Path    string
+	Size    int64
+	ModTime time.Time
+	// CreatedAt is when the snapshot was taken, see Created
+	CreatedAt time.Time
+	IsRemote  bool
+}
+
+// Created returns when the snapshot was taken, or its modification time when that is
+// unknown. A copy uploaded or moved later keeps the time it was taken.
+func (s SnapshotFile) Created() time.Time {
+	if s.CreatedAt.IsZero() {
+		return s.ModTime
+	}
+	return s.CreatedAt
+}
+
+// UnifiedStatus holds unified retention decisions by snapshot name, per storage tier
+type UnifiedStatus struct {
+	Local  map[string]bool
+	Remote map[string]bool
 }
 
-// NewManager creates a new retention manager
-func NewManager(policy appconfig.RetentionPolicy) *Manager {
+// NewManager creates a new retention manager with the policies of local and S3 snapshots
+func NewManager(local, remote appconfig.RetentionPolicy) *Manager {
 	return &Manager{
-		policy: policy,
+		local:      local,
+		remote:     remote,
+		now:        time.Now,
+		nameLayout: DefaultNameLayout,
 	}
 }
 
+// WithNameLayout sets the time layout at the start of snapshot names, an empty layout
+// dates snapshots by their manifest or modification time only
+func (m *Manager) WithNameLayout(layout string) *Manager {
+	m.nameLayout = layout
+	return m
+}
+
+// WithClock makes the manager evaluate retention periods against now instead of the
+// system clock
+func (m *Manager) WithClock(now func() time.Time) *Manager {
+	m.now = now
+	return m
+}
+
 // ApplyLocal applies retention policies to local snapshots
 func (m *Manager) ApplyLocal(snapshotDir string, dryRun bool) error {
 	log.Info(PKG_RETENTION, "Applying local retention policies")
@@ -50,7 +97,7 @@ func (m *Manager) ApplyLocal(snapshotDir string, dryRun bool) error {
 	}
 
 	// Determine which snapshots to keep
-	toKeep := m.determineSnapshotsToKeep(snapshots)
+	toKeep := determineSnapshotsToKeep(snapshots, nil, m.local, "local", m.now())
 	toDelete := m.findSnapshotsToDelete(snapshots, toKeep)
 
 	// Delete snapshots
@@ -59,11 +106,10 @@ func (m *Manager) ApplyLocal(snapshotDir string, dryRun bool) error {
 			log.Warnf(PKG_RETENTION, "[DRY RUN] Would delete local snapshot: %s", snapshot.Name)
 		} else {
 			log.Warnf(PKG_RETENTION, "Deleting local snapshot: %s", snapshot.Name)
-			if err := os.Remove(snapshot.Path); err != nil {
-				log.Errorf(PKG_RETENTION, err, "Failed to delete local snapshot '%s'", snapshot.Path)
-			}
+			removeLocalSnapshot(snapshot)
 		}
 	}
+	pruneLocalSegments(snapshotDir, snapshots, toKeep, dryRun)
 
 	if dryRun {
 		log.Infof(PKG_RETENTION, "Local retention dry run complete: %d snapshots would be kept, %d would be deleted", len(toKeep), len(toDelete))
@@ -84,24 +130,27 @@ func (m *Manager) ApplyS3(ctx context.Context, s3Client *s3.Client, dryRun bool)
 	}
 
 	// Determine which snapshots to keep
-	toKeep := m.determineSnapshotsToKeep(snapshots)
+	toKeep := determineSnapshotsToKeep(snapshots, nil, m.remote, "S3", m.now())
 	toDelete := m.findSnapshotsToDelete(snapshots, toKeep)
 
 	// Delete snapshots
 	var keys []string
 	for _, snapshot := range toDelete {
-		keys = append(keys, snapshot.Path) // For S3, Path contains the key
+		keys = append(keys, snapshot.Path, manifest.Name(snapshot.Path)) // For S3, Path contains the key
 		if dryRun {
 			log.Warnf(PKG_RETENTION, "[DRY RUN] Would delete S3 snapshot: %s", snapshot.Name)
 		}
 	}
 
 	if len(keys) > 0 && !dryRun {
-		log.Warnf(PKG_RETENTION, "Deleting %d S3 snapshots", len(keys))
+		log.Warnf(PKG_RETENTION, "Deleting %d S3 snapshots", len(toDelete))
 		if err := s3Client.DeleteMultiple(ctx, keys); err != nil {
 			return fmt.Errorf("failed to delete S3 snapshots: %w", err)
 		}
 	}
+	if err := pruneS3Segments(ctx, s3Client, snapshots, toKeep, dryRun); err != nil {
+		return err
+	}
 
 	if dryRun {
 		log.Infof(PKG_RETENTION, "S3 retention dry run complete: %d snapshots would be kept, %d would be deleted", len(toKeep), len(toDelete))
@@ -111,19 +160,55 @@ func (m *Manager) ApplyS3(ctx context.Context, s3Client *s3.Client, dryRun bool)
 	return nil
 }
 
-// GetRetentionStatus returns a map indicating which snapshots should be kept
-func (m *Manager) GetRetentionStatus(snapshots []SnapshotFile) map[string]bool {
-	return m.determineSnapshotsToKeep(snapshots)
+// GetLocalRetentionStatus returns which snapshots the local policy keeps
+func (m *Manager) GetLocalRetentionStatus(snapshots []SnapshotFile) map[string]bool {
+	return determineSnapshotsToKeep(snapshots, nil, m.local, "local", m.now())
 }
 
-// GetUnifiedRetentionStatus evaluates retention across both local and S3 snapshots
-// This ensures consistent retention decisions for snapshots that exist in multiple locations
-func (m *Manager) GetUnifiedRetentionStatus(localSnapshots, s3Snapshots []SnapshotFile) map[string]bool {
+// GetRemoteRetentionStatus returns which snapshots the S3 policy keeps, wherever they are
+// stored. It lists S3 snapshots and decides which local snapshots are worth uploading.
+func (m *Manager) GetRemoteRetentionStatus(snapshots []SnapshotFile) map[string]bool {
+	return determineSnapshotsToKeep(snapshots, nil, m.remote, "S3", m.now())
+}
+
+// GetUnifiedRetentionStatus evaluates retention across both local and S3 snapshots.
+// Every tier applies its own policy to the same unified list, so decisions are consistent
+// for snapshots that exist in both places. Caps only count what each tier holds. With requireRemote a local snapshot is only
+// deleted once a copy of the same size is present in S3.
+func (m *Manager) GetUnifiedRetentionStatus(localSnapshots, s3Snapshots []SnapshotFile, requireRemote bool) UnifiedStatus {
 	// Create a unified list of unique snapshots by name, preferring the most recent version
 	unifiedSnapshots := m.createUnifiedSnapshotList(localSnapshots, s3Snapshots)
 
-	// Apply retention policy to the unified list
-	return m.determineSnapshotsToKeep(unifiedSnapshots)
+	status := UnifiedStatus{
+		Local:  determineSnapshotsToKeep(unifiedSnapshots, snapshotNames(localSnapshots), m.local, "local", m.now()),
+		Remote: determineSnapshotsToKeep(unifiedSnapshots, snapshotNames(s3Snapshots), m.remote, "S3", m.now()),
+	}
+	if !requireRemote {
+		return status
+	}
+
+	uploaded := make(map[string]int64, len(s3Snapshots))
+	for _, snapshot := range s3Snapshots {
+		uploaded[snapshot.Name] = snapshot.Size
+	}
+	for _, snapshot := range localSnapshots {
+		if status.Local[snapshot.Name] {
+			continue
+		}
+		if size, ok := uploaded[snapshot.Name]; !ok || size != snapshot.Size {
+			log.Warnf(PKG_RETENTION, "Keeping local snapshot %s: no copy of it in S3 yet", snapshot.Name)
+			status.Local[snapshot.Name] = true
+		}
+	}
+	return status
+}
+
+// GetUnifiedSnapshots merges local and S3 snapshots by name, the same way unified
+// retention does, and returns them newest first
+func (m *Manager) GetUnifiedSnapshots(localSnapshots, s3Snapshots []SnapshotFile) []SnapshotFile {
+	unified := m.createUnifiedSnapshotList(localSnapshots, s3Snapshots)
+	sortNewestFirst(unified)
+	return unified
 }
 
 // GetLocalSnapshots gets all local snapshot files
@@ -153,11 +238,15 @@ func (m *Manager) GetLocalSnapshots(snapshotDir string) ([]SnapshotFile, error)
 			continue
 		}
 
+		path := filepath.Join(snapshotDir, entry.Name())
 		snapshots = append(snapshots, SnapshotFile{
-			Name:     entry.Name(),
-			Path:     filepath.Join(snapshotDir, entry.Name()),
-			Size:     info.Size(),
-			ModTime:  info.ModTime(),
+			Name:    entry.Name(),
+			Path:    path,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			CreatedAt: m.createdAt(entry.Name(), func() (*manifest.Manifest, error) {
+				return manifest.Load(manifest.Name(path))
+			}, info.ModTime()),
 			IsRemote: false,
 		})
 	}
@@ -174,55 +263,169 @@ func (m *Manager) GetS3Snapshots(ctx context.Context, s3Client *s3.Client) ([]Sn
 		return nil, fmt.Errorf("failed to list S3 objects: %w", err)
 	}
 
+	manifests := make(map[string]bool)
+	for _, obj := range objects {
+		if manifest.IsManifest(obj.Key) {
+			manifests[obj.Key] = true
+		}
+	}
+
 	for _, obj := range objects {
 		if !IsSnapshotFile(obj.Key) {
 			continue
 		}
 
+		// Manifests are only downloaded for snapshots not dated by their name
+		var readManifest func() (*manifest.Manifest, error)
+		if manifests[manifest.Name(obj.Key)] {
+			readManifest = func() (*manifest.Manifest, error) {
+				data, err := s3Client.ReadObject(ctx, manifest.Name(obj.Key))
+				if err != nil {
+					return nil, err
+				}
+				return manifest.Parse(data)
+			}
+		}
+
 		snapshots = append(snapshots, SnapshotFile{
-			Name:     filepath.Base(obj.Key),
-			Path:     obj.Key, // For S3, store the full key as path
-			Size:     obj.Size,
-			ModTime:  obj.LastModified,
-			IsRemote: true,
+			Name:      filepath.Base(obj.Key),
+			Path:      obj.Key, // For S3, store the full key as path
+			Size:      obj.Size,
+			ModTime:   obj.LastModified,
+			CreatedAt: m.createdAt(filepath.Base(obj.Key), readManifest, obj.LastModified),
+			IsRemote:  true,
 		})
 	}
 
 	return snapshots, nil
 }
 
-// determineSnapshotsToKeep determines which snapshots should be kept based on retention policies
-func (m *Manager) determineSnapshotsToKeep(snapshots []SnapshotFile) map[string]bool {
-	toKeep := make(map[string]bool)
-	now := time.Now()
+// createdAt returns when a snapshot was taken: the time stamp at the start of its name,
+// else the creation time in its manifest, else its modification time, which changes
+// when a snapshot is uploaded or copied. Name time stamps are in UTC, as the snapshot
+// command writes them, unless the layout has a zone; names written by older versions
+// have no zone suffix and are read in local time. An empty layout disables both.
+func (m *Manager) createdAt(name string, readManifest func() (*manifest.Manifest, error), modTime time.Time) time.Time {
+	if len(m.nameLayout) > 0 {
+		if created, ok := parseNameTime(name, m.nameLayout, time.UTC); ok {
+			return created
+		}
+		if created, ok := parseNameTime(name, legacyNameLayout, time.Local); ok {
+			return created
+		}
+	}
+
+	if readManifest != nil {
+		snapshotManifest, err := readManifest()
+		switch {
+		case err == nil && !snapshotManifest.CreatedAt.IsZero():
+			return snapshotManifest.CreatedAt
+		case err != nil && !errors.Is(err, os.ErrNotExist):
+			log.Debugf(PKG_RETENTION, "Snapshot %s: no creation time from manifest: %v", name, err)
+		}
+	}
+
+	log.Debugf(PKG_RETENTION, "Snapshot %s: dated by modification time", name)
+	return modTime
+}
 
-	log.Infof(PKG_RETENTION, "Evaluating retention for %d snapshots", len(snapshots))
-	log.Infof(PKG_RETENTION, "Retention policy: KeepLast=%d, KeepLastDays=%d, KeepLastHours=%d, KeepLastWeeks=%d, KeepLastMonths=%d, KeepLastYears=%d",
-		m.policy.KeepLast, m.policy.KeepLastDays, m.policy.KeepLastHours, m.policy.KeepLastWeeks, m.policy.KeepLastMonths, m.policy.KeepLastYears)
+// parseNameTime parses the time stamp at the start of a snapshot name with layout, in loc
+// unless the layout has a zone
+func parseNameTime(name, layout string, loc *time.Location) (time.Time, bool) {
+	if len(layout) == 0 || len(name) < len(layout) {
+		return time.Time{}, false
+	}
+	// A layout without a year matches any name with the same literal text
+	created, err := time.ParseInLocation(layout, name[:len(layout)], loc)
+	if err != nil || created.Year() <= 0 {
+		return time.Time{}, false
+	}
+	return created, true
+}
 
-	// Sort snapshots by modification time (newest first)
+// determineSnapshotsToKeep determines which snapshots should be kept based on retention
+// policies, with periods counted back from now in the time zone of the policy. stored
+// names the snapshots the tier holds, the ones its caps apply to; nil means all of them.
+func determineSnapshotsToKeep(snapshots []SnapshotFile, stored map[string]bool, policy appconfig.RetentionPolicy, tier string, now time.Time) map[string]bool {
+	loc, err := policy.Location()
+	if err != nil {
+		log.Warnf(PKG_RETENTION, "%v, using the local time zone", err)
+		loc = time.Local
+	}
+	now = now.In(loc)
+
+	log.Infof(PKG_RETENTION, "Evaluating %s retention for %d snapshots", tier, len(snapshots))
+	log.Infof(PKG_RETENTION, "Retention policy: Mode=%s, KeepLast=%d, KeepLastDays=%d, KeepLastHours=%d, KeepLastWeeks=%d, KeepLastMonths=%d, KeepLastYears=%d, TimeZone=%s, MaxCount=%d, MaxTotalBytes=%d",
+		policyMode(policy), policy.KeepLast, policy.KeepLastDays, policy.KeepLastHours, policy.KeepLastWeeks, policy.KeepLastMonths, policy.KeepLastYears, loc, policy.MaxCount, policy.MaxTotalBytes)
+
+	sortNewestFirst(snapshots)
+
+	var toKeep map[string]bool
+	if policyMode(policy) == ModeAge {
+		toKeep = keepByAge(snapshots, policy, now)
+	} else {
+		toKeep = keepGFS(snapshots, policy, loc)
+	}
+	applyCaps(snapshots, stored, toKeep, policy, tier)
+
+	log.Infof(PKG_RETENTION, "Retention evaluation complete: %d snapshots to keep, %d to delete",
+		len(toKeep), len(snapshots)-len(toKeep))
+
+	return toKeep
+}
+
+// snapshotNames returns the set of snapshot names
+func snapshotNames(snapshots []SnapshotFile) map[string]bool {
+	names := make(map[string]bool, len(snapshots))
+	for _, snapshot := range snapshots {
+		names[snapshot.Name] = true
+	}
+	return names
+}
+
+// sortNewestFirst sorts snapshots by the time they were taken, newest first
+func sortNewestFirst(snapshots []SnapshotFile) {
 	sort.Slice(snapshots, func(i, j int) bool {
-		return snapshots[i].ModTime.After(snapshots[j].ModTime)
+		if !snapshots[i].Created().Equal(snapshots[j].Created()) {
+			return snapshots[i].Created().After(snapshots[j].Created())
+		}
+		return snapshots[i].Name > snapshots[j].Name
 	})
+}
+
+// policyMode returns the retention mode, GFS unless age windows are configured
+func policyMode(policy appconfig.RetentionPolicy) string {
+	if policy.Mode == ModeAge {
+		return ModeAge
+	}
+	return ModeGFS
+}
+
+// keepByAge keeps snapshots younger than the configured windows. With several policies
+// a snapshot must match all of them, so the shortest window wins. Days, weeks, months
+// and years are calendar periods in the time zone of now: a day across a DST change is
+// 23 or 25 hours, and a month back from March 31 ends on the last day of February.
+func keepByAge(snapshots []SnapshotFile, policy appconfig.RetentionPolicy, now time.Time) map[string]bool {
+	toKeep := make(map[string]bool)
 
 	// Count active policies to determine if we use union or intersection logic
 	activePolicies := 0
-	if m.policy.KeepLast > 0 {
+	if policy.KeepLast > 0 {
 		activePolicies++
 	}
-	if m.policy.KeepLastHours > 0 {
+	if policy.KeepLastHours > 0 {
 		activePolicies++
 	}
-	if m.policy.KeepLastDays > 0 {
+	if policy.KeepLastDays > 0 {
 		activePolicies++
 	}
-	if m.policy.KeepLastWeeks > 0 {
+	if policy.KeepLastWeeks > 0 {
 		activePolicies++
 	}
-	if m.policy.KeepLastMonths > 0 {
+	if policy.KeepLastMonths > 0 {
 		activePolicies++
 	}
-	if m.policy.KeepLastYears > 0 {
+	if policy.KeepLastYears > 0 {
 		activePolicies++
 	}
 
@@ -248,10 +451,10 @@ func (m *Manager) determineSnapshotsToKeep(snapshots []SnapshotFile) map[string]
 	}
 
 	// Apply count-based retention (KeepLast)
-	if m.policy.KeepLast > 0 {
-		log.Infof(PKG_RETENTION, "Applying KeepLast policy: keeping %d newest snapshots", m.policy.KeepLast)
+	if policy.KeepLast > 0 {
+		log.Infof(PKG_RETENTION, "Applying KeepLast policy: keeping %d newest snapshots", policy.KeepLast)
 		for i, snapshot := range snapshots {
-			if i < m.policy.KeepLast {
+			if i < policy.KeepLast {
 				if useIntersection {
 					candidates[snapshot.Name]++
 				} else {
@@ -263,34 +466,27 @@ func (m *Manager) determineSnapshotsToKeep(snapshots []SnapshotFile) map[string]
 	}
 
 	// Apply time-based retention policies
+	windows := []struct {
+		policy string
+		cutoff time.Time
+		active bool
+	}{
+		{"KeepLastHours", now.Add(-time.Duration(policy.KeepLastHours) * time.Hour), policy.KeepLastHours > 0},
+		{"KeepLastDays", now.AddDate(0, 0, -policy.KeepLastDays), policy.KeepLastDays > 0},
+		{"KeepLastWeeks", now.AddDate(0, 0, -7*policy.KeepLastWeeks), policy.KeepLastWeeks > 0},
+		{"KeepLastMonths", monthsBefore(now, policy.KeepLastMonths), policy.KeepLastMonths > 0},
+		{"KeepLastYears", monthsBefore(now, 12*policy.KeepLastYears), policy.KeepLastYears > 0},
+	}
 	for _, snapshot := range snapshots {
-		age := now.Sub(snapshot.ModTime)
+		age := now.Sub(snapshot.Created())
 		policyMatches := 0
 		var matchedPolicies []string
 
-		if m.policy.KeepLastHours > 0 && age <= time.Duration(m.policy.KeepLastHours)*time.Hour {
-			policyMatches++
-			matchedPolicies = append(matchedPolicies, "KeepLastHours")
-		}
-
-		if m.policy.KeepLastDays > 0 && age <= time.Duration(m.policy.KeepLastDays)*24*time.Hour {
-			policyMatches++
-			matchedPolicies = append(matchedPolicies, "KeepLastDays")
-		}
-
-		if m.policy.KeepLastWeeks > 0 && age <= time.Duration(m.policy.KeepLastWeeks)*7*24*time.Hour {
-			policyMatches++
-			matchedPolicies = append(matchedPolicies, "KeepLastWeeks")
-		}
-
-		if m.policy.KeepLastMonths > 0 && age <= time.Duration(m.policy.KeepLastMonths)*30*24*time.Hour {
-			policyMatches++
-			matchedPolicies = append(matchedPolicies, "KeepLastMonths")
-		}
-
-		if m.policy.KeepLastYears > 0 && age <= time.Duration(m.policy.KeepLastYears)*365*24*time.Hour {
-			policyMatches++
-			matchedPolicies = append(matchedPolicies, "KeepLastYears")
+		for _, window := range windows {
+			if window.active && !snapshot.Created().Before(window.cutoff) {
+				policyMatches++
+				matchedPolicies = append(matchedPolicies, window.policy)
+			}
 		}
 
 		if len(matchedPolicies) > 0 {
@@ -317,12 +513,18 @@ func (m *Manager) determineSnapshotsToKeep(snapshots []SnapshotFile) map[string]
 		}
 	}
 
-	log.Infof(PKG_RETENTION, "Retention evaluation complete: %d snapshots to keep, %d to delete",
-		len(toKeep), len(snapshots)-len(toKeep))
-
 	return toKeep
 }
 
+// monthsBefore returns t moved back n calendar months, on the last day of the target
+// month when it is shorter than the day of t
+func monthsBefore(t time.Time, n int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month-time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(day, lastDay)-1)
+}
+
 // findSnapshotsToDelete finds snapshots that should be deleted
 func (m *Manager) findSnapshotsToDelete(snapshots []SnapshotFile, toKeep map[string]bool) []SnapshotFile {
 	var toDelete []SnapshotFile
@@ -338,6 +540,15 @@ func (m *Manager) findSnapshotsToDelete(snapshots []SnapshotFile, toKeep map[str
 
 // IsSnapshotFile determines if a filename represents a snapshot file
 func IsSnapshotFile(filename string) bool {
+	// Manifests sit next to snapshots and share their name
+	if manifest.IsManifest(filename) {
+		return false
+	}
+	// Logical exports may share the snapshot directory and bucket
+	if etcd.IsExportFile(filename) {
+		return false
+	}
+
 	ext := filepath.Ext(filename)
 	if ext == ".db" || slices.Contains(compression.AllCompressionExts(), ext) {
 		return true
@@ -352,7 +563,8 @@ func IsSnapshotFile(filename string) bool {
 }
 
 // createUnifiedSnapshotList combines local and S3 snapshots into a unified list
-// For snapshots that exist in both locations, it uses the most recent timestamp
+// For snapshots that exist in both locations, it uses the most recent creation time,
+// the local copy when both agree
 func (m *Manager) createUnifiedSnapshotList(localSnapshots, s3Snapshots []SnapshotFile) []SnapshotFile {
 	snapshotMap := make(map[string]SnapshotFile)
 
@@ -365,7 +577,7 @@ func (m *Manager) createUnifiedSnapshotList(localSnapshots, s3Snapshots []Snapsh
 	for _, s3Snapshot := range s3Snapshots {
 		if existing, exists := snapshotMap[s3Snapshot.Name]; exists {
 			// Keep the more recent version
-			if s3Snapshot.ModTime.After(existing.ModTime) {
+			if s3Snapshot.Created().After(existing.Created()) {
 				snapshotMap[s3Snapshot.Name] = s3Snapshot
 			}
 		} else {
@@ -401,16 +613,20 @@ func (m *Manager) ApplyUnified(ctx context.Context, snapshotDir string, s3Client
 		}
 	}
 
-	// Get unified retention decisions
-	retentionDecisions := m.GetUnifiedRetentionStatus(localSnapshots, s3Snapshots)
+	// Get unified retention decisions, local copies are only deleted once they are in S3
+	retentionDecisions := m.GetUnifiedRetentionStatus(localSnapshots, s3Snapshots, s3Client != nil)
 
 	// Apply decisions to local snapshots
-	localKept, localDeleted := m.applyRetentionToLocal(localSnapshots, retentionDecisions, dryRun)
+	localKept, localDeleted := m.applyRetentionToLocal(localSnapshots, retentionDecisions.Local, dryRun)
+	pruneLocalSegments(snapshotDir, localSnapshots, retentionDecisions.Local, dryRun)
 
 	// Apply decisions to S3 snapshots
 	var s3Kept, s3Deleted int
 	if s3Client != nil {
-		s3Kept, s3Deleted = m.applyRetentionToS3(ctx, s3Client, s3Snapshots, retentionDecisions, dryRun)
+		s3Kept, s3Deleted = m.applyRetentionToS3(ctx, s3Client, s3Snapshots, retentionDecisions.Remote, dryRun)
+		if err := pruneS3Segments(ctx, s3Client, s3Snapshots, retentionDecisions.Remote, dryRun); err != nil {
+			log.Errorf(PKG_RETENTION, err, "Failed to prune S3 segments")
+		}
 	}
 
 	if dryRun {
@@ -435,9 +651,7 @@ func (m *Manager) applyRetentionToLocal(snapshots []SnapshotFile, retentionDecis
 				log.Warnf(PKG_RETENTION, "[DRY RUN] Would delete local snapshot: %s", snapshot.Name)
 			} else {
 				log.Warnf(PKG_RETENTION, "Deleting local snapshot: %s", snapshot.Name)
-				if err := os.Remove(snapshot.Path); err != nil {
-					log.Errorf(PKG_RETENTION, err, "Failed to delete local snapshot '%s'", snapshot.Path)
-				}
+				removeLocalSnapshot(snapshot)
 			}
 		}
 	}
@@ -453,7 +667,7 @@ func (m *Manager) applyRetentionToS3(ctx context.Context, s3Client *s3.Client, s
 			kept++
 		} else {
 			deleted++
-			keysToDelete = append(keysToDelete, snapshot.Path)
+			keysToDelete = append(keysToDelete, snapshot.Path, manifest.Name(snapshot.Path))
 			if dryRun {
 				log.Warnf(PKG_RETENTION, "[DRY RUN] Would delete S3 snapshot: %s", snapshot.Name)
 			}
@@ -461,7 +675,7 @@ func (m *Manager) applyRetentionToS3(ctx context.Context, s3Client *s3.Client, s
 	}
 
 	if len(keysToDelete) > 0 && !dryRun {
-		log.Warnf(PKG_RETENTION, "Deleting %d S3 snapshots", len(keysToDelete))
+		log.Warnf(PKG_RETENTION, "Deleting %d S3 snapshots", deleted)
 		if err := s3Client.DeleteMultiple(ctx, keysToDelete); err != nil {
 			log.Errorf(PKG_RETENTION, err, "Failed to delete S3 snapshots")
 		}
@@ -469,3 +683,15 @@ func (m *Manager) applyRetentionToS3(ctx context.Context, s3Client *s3.Client, s
 
 	return kept, deleted
 }
+
+// removeLocalSnapshot deletes a local snapshot file and its manifest, if any
+func removeLocalSnapshot(snapshot SnapshotFile) {
+	if err := os.Remove(snapshot.Path); err != nil {
+		log.Errorf(PKG_RETENTION, err, "Failed to delete local snapshot '%s'", snapshot.Path)
+	}
+
+	manifestPath := manifest.Name(snapshot.Path)
+	if err := os.Remove(manifestPath); err != nil && !os.IsNotExist(err) {
+		log.Errorf(PKG_RETENTION, err, "Failed to delete local snapshot manifest '%s'", manifestPath)
+	}
+}
@@ -0,0 +1,388 @@
+package retention
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	"github.com/thedataflows/etcd2s3/pkg/manifest"
+	"github.com/thedataflows/etcd2s3/pkg/segment"
+)
+
+// dailySnapshots returns one snapshot per day at noon, from first to last inclusive
+func dailySnapshots(first, last time.Time) []SnapshotFile {
+	var snapshots []SnapshotFile
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		snapshots = append(snapshots, SnapshotFile{Name: "etcd-snapshot-" + day.Format("20060102") + ".db", ModTime: day.Add(12 * time.Hour)})
+	}
+	return snapshots
+}
+
+// kept returns the sorted names of the snapshots to keep
+func kept(toKeep map[string]bool) []string {
+	var names []string
+	for name, keep := range toKeep {
+		if keep {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDetermineSnapshotsToKeep(tMain *testing.T) {
+	snapshots := dailySnapshots(time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local), time.Date(2024, 3, 31, 0, 0, 0, 0, time.Local))
+
+	tests := []struct {
+		name     string
+		policy   appconfig.RetentionPolicy
+		expected []string
+	}{
+		{
+			name:   "gfs keeps the newest snapshot per period",
+			policy: appconfig.RetentionPolicy{Mode: ModeGFS, KeepLastDays: 3, KeepLastWeeks: 2, KeepLastMonths: 3, KeepLastYears: 2},
+			expected: []string{
+				"etcd-snapshot-20231231.db", // 2023
+				"etcd-snapshot-20240131.db", // January
+				"etcd-snapshot-20240229.db", // February
+				"etcd-snapshot-20240324.db", // previous ISO week
+				"etcd-snapshot-20240329.db",
+				"etcd-snapshot-20240330.db",
+				"etcd-snapshot-20240331.db", // newest of every period
+			},
+		},
+		{
+			name:   "gfs keeps a year of monthly history",
+			policy: appconfig.RetentionPolicy{KeepLastMonths: 12},
+			expected: []string{
+				"etcd-snapshot-20230430.db", "etcd-snapshot-20230531.db", "etcd-snapshot-20230630.db",
+				"etcd-snapshot-20230731.db", "etcd-snapshot-20230831.db", "etcd-snapshot-20230930.db",
+				"etcd-snapshot-20231031.db", "etcd-snapshot-20231130.db", "etcd-snapshot-20231231.db",
+				"etcd-snapshot-20240131.db", "etcd-snapshot-20240229.db", "etcd-snapshot-20240331.db",
+			},
+		},
+		{
+			name:   "gfs unions keep last",
+			policy: appconfig.RetentionPolicy{Mode: ModeGFS, KeepLast: 3, KeepLastYears: 1},
+			expected: []string{
+				"etcd-snapshot-20240329.db", "etcd-snapshot-20240330.db", "etcd-snapshot-20240331.db",
+			},
+		},
+		{
+			name:     "nothing configured",
+			policy:   appconfig.RetentionPolicy{},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		tMain.Run(tt.name, func(t *testing.T) {
+			input := append([]SnapshotFile(nil), snapshots...)
+			assert.Equal(t, tt.expected, kept(determineSnapshotsToKeep(input, nil, tt.policy, "local", time.Now())))
+		})
+	}
+
+	tMain.Run("age windows intersect", func(t *testing.T) {
+		now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+		var hourly []SnapshotFile
+		for i := range 48 {
+			hourly = append(hourly, SnapshotFile{Name: fmt.Sprintf("etcd-snapshot-%02d.db", i), ModTime: now.Add(-time.Duration(i)*time.Hour - time.Minute)})
+		}
+
+		policy := appconfig.RetentionPolicy{Mode: ModeAge, KeepLast: 30, KeepLastHours: 10}
+		toKeep := kept(determineSnapshotsToKeep(hourly, nil, policy, "local", now))
+		assert.Len(t, toKeep, 10, "only snapshots matching both policies")
+		assert.Contains(t, toKeep, "etcd-snapshot-00.db")
+		assert.NotContains(t, toKeep, "etcd-snapshot-10.db")
+	})
+}
+
+// hourlySnapshots returns one snapshot per hour, n hours back from newest inclusive
+func hourlySnapshots(newest time.Time, n int) []SnapshotFile {
+	var snapshots []SnapshotFile
+	for i := range n {
+		at := newest.Add(-time.Duration(i) * time.Hour)
+		snapshots = append(snapshots, SnapshotFile{Name: "etcd-snapshot-" + at.UTC().Format("20060102-1504") + ".db", ModTime: at})
+	}
+	return snapshots
+}
+
+func TestCalendarPeriods(tMain *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		tMain.Skipf("time zone data not available: %v", err)
+	}
+	march31 := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		snapshots []SnapshotFile
+		policy    appconfig.RetentionPolicy
+		count     int
+		oldest    string
+	}{
+		{
+			name:      "month back from March 31 is February 29",
+			now:       march31,
+			snapshots: dailySnapshots(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)),
+			policy:    appconfig.RetentionPolicy{Mode: ModeAge, KeepLastMonths: 1, TimeZone: "UTC"},
+			count:     32,
+			oldest:    "etcd-snapshot-20240229.db",
+		},
+		{
+			name:      "three months back from May 31 is February 29",
+			now:       time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC),
+			snapshots: dailySnapshots(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)),
+			policy:    appconfig.RetentionPolicy{Mode: ModeAge, KeepLastMonths: 3, TimeZone: "UTC"},
+			count:     93,
+			oldest:    "etcd-snapshot-20240229.db",
+		},
+		{
+			name:      "year back from February 29 is February 28",
+			now:       time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC),
+			snapshots: dailySnapshots(time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)),
+			policy:    appconfig.RetentionPolicy{Mode: ModeAge, KeepLastYears: 1, TimeZone: "UTC"},
+			count:     367,
+			oldest:    "etcd-snapshot-20230228.db",
+		},
+		{
+			name:      "day across DST start is 23 hours",
+			now:       time.Date(2024, 3, 10, 12, 0, 0, 0, newYork),
+			snapshots: hourlySnapshots(time.Date(2024, 3, 10, 12, 0, 0, 0, newYork), 30),
+			policy:    appconfig.RetentionPolicy{Mode: ModeAge, KeepLastDays: 1, TimeZone: "America/New_York"},
+			count:     24,
+			oldest:    "etcd-snapshot-20240309-1700.db",
+		},
+		{
+			name:      "day across DST end is 25 hours",
+			now:       time.Date(2024, 11, 3, 12, 0, 0, 0, newYork),
+			snapshots: hourlySnapshots(time.Date(2024, 11, 3, 12, 0, 0, 0, newYork), 30),
+			policy:    appconfig.RetentionPolicy{Mode: ModeAge, KeepLastDays: 1, TimeZone: "America/New_York"},
+			count:     26,
+			oldest:    "etcd-snapshot-20241102-1600.db",
+		},
+		{
+			name:      "gfs keeps both repeated hours when DST ends",
+			now:       time.Date(2024, 11, 3, 2, 30, 0, 0, newYork),
+			snapshots: hourlySnapshots(time.Date(2024, 11, 3, 2, 30, 0, 0, newYork), 4),
+			policy:    appconfig.RetentionPolicy{KeepLastHours: 4, TimeZone: "America/New_York"},
+			count:     4,
+			oldest:    "etcd-snapshot-20241103-0430.db",
+		},
+		{
+			name: "gfs days follow the time zone",
+			now:  time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC),
+			snapshots: []SnapshotFile{
+				{Name: "a.db", ModTime: time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC)},
+				{Name: "b.db", ModTime: time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC)},
+				{Name: "c.db", ModTime: time.Date(2024, 1, 2, 0, 30, 0, 0, time.UTC)},
+			},
+			policy: appconfig.RetentionPolicy{KeepLastDays: 2, TimeZone: "America/New_York"},
+			count:  1,
+			oldest: "c.db",
+		},
+		{
+			name: "gfs days in UTC",
+			now:  time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC),
+			snapshots: []SnapshotFile{
+				{Name: "a.db", ModTime: time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC)},
+				{Name: "b.db", ModTime: time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC)},
+				{Name: "c.db", ModTime: time.Date(2024, 1, 2, 0, 30, 0, 0, time.UTC)},
+			},
+			policy: appconfig.RetentionPolicy{KeepLastDays: 2, TimeZone: "UTC"},
+			count:  2,
+			oldest: "b.db",
+		},
+	}
+
+	for _, tt := range tests {
+		tMain.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(tt.policy, tt.policy).WithClock(func() time.Time { return tt.now })
+			toKeep := kept(manager.GetLocalRetentionStatus(tt.snapshots))
+			assert.Len(t, toKeep, tt.count)
+			if assert.NotEmpty(t, toKeep) {
+				assert.Equal(t, tt.oldest, toKeep[0])
+			}
+		})
+	}
+}
+
+func TestGetUnifiedRetentionStatus(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	snapshot := func(name string, hour int, size int64, remote bool) SnapshotFile {
+		return SnapshotFile{Name: name, Size: size, ModTime: base.Add(time.Duration(hour) * time.Hour), IsRemote: remote}
+	}
+	local := []SnapshotFile{
+		snapshot("s1.db", 1, 100, false),
+		snapshot("s2.db", 2, 100, false),
+		snapshot("s3.db", 3, 100, false),
+		snapshot("s4.db", 4, 100, false),
+	}
+	s3Snapshots := []SnapshotFile{
+		snapshot("s1.db", 1, 100, true),
+		snapshot("s2.db", 2, 50, true), // incomplete upload
+		snapshot("s3.db", 3, 100, true),
+	}
+	manager := NewManager(appconfig.RetentionPolicy{KeepLast: 1}, appconfig.RetentionPolicy{KeepLast: 3})
+
+	status := manager.GetUnifiedRetentionStatus(local, s3Snapshots, true)
+	assert.Equal(t, []string{"s2.db", "s3.db", "s4.db"}, kept(status.Remote))
+	assert.Equal(t, []string{"s2.db", "s4.db"}, kept(status.Local), "local copies without a complete S3 copy are kept")
+
+	status = manager.GetUnifiedRetentionStatus(local, nil, false)
+	assert.Equal(t, []string{"s4.db"}, kept(status.Local), "without S3 only the local policy applies")
+}
+
+func TestTierRetentionStatus(t *testing.T) {
+	snapshots := dailySnapshots(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC))
+	manager := NewManager(appconfig.RetentionPolicy{KeepLast: 1}, appconfig.RetentionPolicy{KeepLast: 3})
+
+	// The tier is named by the caller, not taken from the snapshots
+	assert.Len(t, kept(manager.GetLocalRetentionStatus(snapshots)), 1)
+	assert.Len(t, kept(manager.GetRemoteRetentionStatus(snapshots)), 3)
+	assert.Empty(t, manager.GetRemoteRetentionStatus(nil))
+}
+
+func TestSnapshotCreationTime(t *testing.T) {
+	dir := t.TempDir()
+	modTime := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	fromManifest := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	names := []string{"etcd-snapshot-20240102-030405Z.db.zst", "etcd-snapshot-20240301-090000.db", "manual-snapshot.db", "other-snapshot.db"}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("snapshot"), 0644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	// A custom name, the name in local time written by an older version has no manifest
+	require.NoError(t, (&manifest.Manifest{Snapshot: names[2], CreatedAt: fromManifest}).Save(filepath.Join(dir, manifest.Name(names[2]))))
+
+	created := func(manager *Manager) map[string]time.Time {
+		snapshots, err := manager.GetLocalSnapshots(dir)
+		require.NoError(t, err)
+		times := make(map[string]time.Time)
+		for _, snapshot := range snapshots {
+			times[snapshot.Name] = snapshot.Created()
+		}
+		return times
+	}
+
+	times := created(NewManager(appconfig.RetentionPolicy{}, appconfig.RetentionPolicy{}))
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), times["etcd-snapshot-20240102-030405Z.db.zst"], "from name, in UTC")
+	assert.True(t, time.Date(2024, 3, 1, 9, 0, 0, 0, time.Local).Equal(times["etcd-snapshot-20240301-090000.db"]), "legacy name, in local time")
+	assert.True(t, fromManifest.Equal(times["manual-snapshot.db"]), "from manifest")
+	assert.True(t, modTime.Equal(times["other-snapshot.db"]), "from modification time")
+
+	times = created(NewManager(appconfig.RetentionPolicy{}, appconfig.RetentionPolicy{}).WithNameLayout(""))
+	assert.True(t, modTime.Equal(times["etcd-snapshot-20240102-030405Z.db.zst"]), "name layout disabled")
+	assert.True(t, modTime.Equal(times["etcd-snapshot-20240301-090000.db"]), "name layout disabled for legacy names")
+
+	times = created(NewManager(appconfig.RetentionPolicy{}, appconfig.RetentionPolicy{}).WithNameLayout("manual-snapshot"))
+	assert.True(t, fromManifest.Equal(times["manual-snapshot.db"]), "layout without time stamp falls back to the manifest")
+}
+
+func TestReuploadedSnapshotKeepsCreationTime(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 12, 0, 0, 0, time.UTC) }
+	local := []SnapshotFile{
+		{Name: "old.db", Size: 100, ModTime: day(1), CreatedAt: day(1)},
+		{Name: "new.db", Size: 100, ModTime: day(2), CreatedAt: day(2)},
+	}
+	// old.db was uploaded after new.db, S3 dates it by the upload
+	s3Snapshots := []SnapshotFile{
+		{Name: "new.db", Size: 100, ModTime: day(2), CreatedAt: day(2), IsRemote: true},
+		{Name: "old.db", Size: 100, ModTime: day(5), CreatedAt: day(1), IsRemote: true},
+	}
+	manager := NewManager(appconfig.RetentionPolicy{KeepLast: 1}, appconfig.RetentionPolicy{KeepLast: 1})
+
+	status := manager.GetUnifiedRetentionStatus(local, s3Snapshots, true)
+	assert.Equal(t, []string{"new.db"}, kept(status.Remote))
+	assert.Equal(t, []string{"new.db"}, kept(status.Local))
+	assert.Equal(t, "new.db", manager.GetUnifiedSnapshots(local, s3Snapshots)[0].Name)
+}
+
+func TestRetentionCaps(tMain *testing.T) {
+	snapshots := dailySnapshots(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC))
+	for i := range snapshots {
+		snapshots[i].Size = 100
+	}
+	now := time.Date(2024, 3, 10, 18, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		policy appconfig.RetentionPolicy
+		count  int
+		oldest string
+	}{
+		{name: "no caps", policy: appconfig.RetentionPolicy{KeepLast: 3, KeepLastDays: 10}, count: 10, oldest: "etcd-snapshot-20240301.db"},
+		{name: "max count", policy: appconfig.RetentionPolicy{KeepLast: 3, KeepLastDays: 10, MaxCount: 5}, count: 5, oldest: "etcd-snapshot-20240306.db"},
+		{name: "max total bytes", policy: appconfig.RetentionPolicy{KeepLast: 3, KeepLastDays: 10, MaxTotalBytes: 450}, count: 4, oldest: "etcd-snapshot-20240307.db"},
+		{name: "keep last wins over caps", policy: appconfig.RetentionPolicy{KeepLast: 3, KeepLastDays: 10, MaxCount: 2, MaxTotalBytes: 50}, count: 3, oldest: "etcd-snapshot-20240308.db"},
+		{name: "age mode", policy: appconfig.RetentionPolicy{Mode: ModeAge, KeepLastDays: 30, MaxCount: 6, TimeZone: "UTC"}, count: 6, oldest: "etcd-snapshot-20240305.db"},
+	}
+
+	for _, tt := range tests {
+		tMain.Run(tt.name, func(t *testing.T) {
+			input := append([]SnapshotFile(nil), snapshots...)
+			toKeep := determineSnapshotsToKeep(input, nil, tt.policy, "S3", now)
+			names := kept(toKeep)
+			assert.Len(t, names, tt.count)
+			if assert.NotEmpty(t, names) {
+				assert.Equal(t, tt.oldest, names[0])
+			}
+			assert.Equal(t, Usage{Count: tt.count, Bytes: int64(tt.count) * 100}, KeptUsage(input, toKeep))
+		})
+	}
+}
+
+func TestUnifiedRetentionCaps(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 12, 0, 0, 0, time.UTC) }
+	snapshot := func(name string, d int, remote bool) SnapshotFile {
+		return SnapshotFile{Name: name, Size: 100, ModTime: day(d), CreatedAt: day(d), IsRemote: remote}
+	}
+	// s1 is only in S3, s4 only on the node, not uploaded yet
+	local := []SnapshotFile{snapshot("s2.db", 2, false), snapshot("s3.db", 3, false), snapshot("s4.db", 4, false)}
+	s3Snapshots := []SnapshotFile{snapshot("s1.db", 1, true), snapshot("s2.db", 2, true), snapshot("s3.db", 3, true)}
+	policy := appconfig.RetentionPolicy{KeepLast: 1, KeepLastDays: 30, MaxTotalBytes: 300, TimeZone: "UTC"}
+	manager := NewManager(policy, policy).WithClock(func() time.Time { return day(5) })
+
+	status := manager.GetUnifiedRetentionStatus(local, s3Snapshots, true)
+	assert.Equal(t, []string{"s1.db", "s2.db", "s3.db", "s4.db"}, kept(status.Remote), "S3 holds 300 bytes, s4 does not count")
+	assert.Equal(t, []string{"s1.db", "s2.db", "s3.db", "s4.db"}, kept(status.Local), "the node holds 300 bytes, s1 does not count")
+
+	policy.MaxTotalBytes = 200
+	manager = NewManager(policy, policy).WithClock(func() time.Time { return day(5) })
+	status = manager.GetUnifiedRetentionStatus(local, s3Snapshots, false)
+	assert.Equal(t, []string{"s2.db", "s3.db", "s4.db"}, kept(status.Remote), "the oldest S3 snapshot goes")
+	assert.Equal(t, []string{"s1.db", "s3.db", "s4.db"}, kept(status.Local), "the oldest local snapshot goes")
+}
+
+func TestApplyLocalPrunesSegments(t *testing.T) {
+	dir := t.TempDir()
+	snapshots := map[string]int64{"etcd-snapshot-20240101-120000Z.db": 10, "etcd-snapshot-20240102-120000Z.db": 20}
+	for name, revision := range snapshots {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("snapshot"), 0644))
+		require.NoError(t, (&manifest.Manifest{Snapshot: name, Revision: revision}).Save(filepath.Join(dir, manifest.Name(name))))
+	}
+	segments := []string{segment.Name(1, 10), segment.Name(11, 20) + ".zst", segment.Name(21, 30)}
+	for _, name := range segments {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	manager := NewManager(appconfig.RetentionPolicy{KeepLast: 1}, appconfig.RetentionPolicy{})
+	require.NoError(t, manager.ApplyLocal(dir, true))
+	for _, name := range segments {
+		assert.FileExists(t, filepath.Join(dir, name), "dry run")
+	}
+
+	require.NoError(t, manager.ApplyLocal(dir, false))
+	assert.NoFileExists(t, filepath.Join(dir, segments[0]))
+	assert.NoFileExists(t, filepath.Join(dir, segments[1]), "covered by the kept snapshot")
+	assert.FileExists(t, filepath.Join(dir, segments[2]), "changes after the kept snapshot")
+	assert.FileExists(t, filepath.Join(dir, "etcd-snapshot-20240102-120000Z.db"))
+}
@@ -0,0 +1,119 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/thedataflows/etcd2s3/pkg/manifest"
+	"github.com/thedataflows/etcd2s3/pkg/s3"
+	"github.com/thedataflows/etcd2s3/pkg/segment"
+	log "github.com/thedataflows/go-lib-log"
+)
+
+// oldestKept returns the oldest snapshot a retention decision keeps
+func oldestKept(snapshots []SnapshotFile, toKeep map[string]bool) (SnapshotFile, bool) {
+	var oldest SnapshotFile
+	found := false
+	for _, snapshot := range snapshots {
+		if toKeep[snapshot.Name] && (!found || snapshot.Created().Before(oldest.Created())) {
+			oldest, found = snapshot, true
+		}
+	}
+	return oldest, found
+}
+
+// prunableSegments returns the segments that end at or before revision, every kept
+// snapshot already contains their changes so no restore replays them
+func prunableSegments(refs []segment.Ref, revision int64) []segment.Ref {
+	var prunable []segment.Ref
+	for _, ref := range refs {
+		if ref.End <= revision {
+			prunable = append(prunable, ref)
+		}
+	}
+	return prunable
+}
+
+// pruneLocalSegments deletes the local segments older than the oldest kept local snapshot.
+// Nothing is deleted when no snapshot is kept or its manifest has no revision.
+func pruneLocalSegments(snapshotDir string, snapshots []SnapshotFile, toKeep map[string]bool, dryRun bool) {
+	oldest, ok := oldestKept(snapshots, toKeep)
+	if !ok {
+		return
+	}
+	snapshotManifest, err := manifest.Load(manifest.Name(oldest.Path))
+	if err != nil || snapshotManifest.Revision == 0 {
+		log.Debugf(PKG_RETENTION, "Keeping local segments: no revision for snapshot %s", oldest.Name)
+		return
+	}
+
+	entries, err := os.ReadDir(snapshotDir)
+	if err != nil {
+		log.Errorf(PKG_RETENTION, err, "Failed to read snapshot directory '%s'", snapshotDir)
+		return
+	}
+	var refs []segment.Ref
+	for _, entry := range entries {
+		if ref, ok := segment.NewRef(filepath.Join(snapshotDir, entry.Name())); ok {
+			refs = append(refs, ref)
+		}
+	}
+
+	for _, ref := range prunableSegments(refs, snapshotManifest.Revision) {
+		if dryRun {
+			log.Warnf(PKG_RETENTION, "[DRY RUN] Would delete local segment: %s", ref.Name)
+			continue
+		}
+		log.Warnf(PKG_RETENTION, "Deleting local segment: %s", ref.Name)
+		if err := os.Remove(ref.Path); err != nil {
+			log.Errorf(PKG_RETENTION, err, "Failed to delete local segment '%s'", ref.Path)
+		}
+	}
+}
+
+// pruneS3Segments deletes the S3 segments older than the oldest kept S3 snapshot.
+// Nothing is deleted when no snapshot is kept or its manifest has no revision.
+func pruneS3Segments(ctx context.Context, s3Client *s3.Client, snapshots []SnapshotFile, toKeep map[string]bool, dryRun bool) error {
+	oldest, ok := oldestKept(snapshots, toKeep)
+	if !ok {
+		return nil
+	}
+	data, err := s3Client.ReadObject(ctx, manifest.Name(oldest.Path))
+	if err != nil {
+		log.Debugf(PKG_RETENTION, "Keeping S3 segments: no manifest for snapshot %s: %v", oldest.Name, err)
+		return nil
+	}
+	snapshotManifest, err := manifest.Parse(data)
+	if err != nil || snapshotManifest.Revision == 0 {
+		log.Debugf(PKG_RETENTION, "Keeping S3 segments: no revision for snapshot %s", oldest.Name)
+		return nil
+	}
+
+	objects, err := s3Client.List(ctx, segment.Prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list S3 segments: %w", err)
+	}
+	var refs []segment.Ref
+	for _, object := range objects {
+		if ref, ok := segment.NewRef(object.Key); ok {
+			refs = append(refs, ref)
+		}
+	}
+
+	var keys []string
+	for _, ref := range prunableSegments(refs, snapshotManifest.Revision) {
+		keys = append(keys, ref.Path)
+		if dryRun {
+			log.Warnf(PKG_RETENTION, "[DRY RUN] Would delete S3 segment: %s", ref.Name)
+		}
+	}
+	if len(keys) > 0 && !dryRun {
+		log.Warnf(PKG_RETENTION, "Deleting %d S3 segments", len(keys))
+		if err := s3Client.DeleteMultiple(ctx, keys); err != nil {
+			return fmt.Errorf("failed to delete S3 segments: %w", err)
+		}
+	}
+	return nil
+}
@@ -151,6 +151,21 @@ func (c *Client) Download(ctx context.Context, key, filePath string) error {
 	return nil
 }
 
+// ReadObject downloads a small object, such as a manifest, into memory
+func (c *Client) ReadObject(ctx context.Context, key string) ([]byte, error) {
+	tempFile, err := os.CreateTemp("", "etcd2s3-object-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	if err := c.Download(ctx, key, tempFile.Name()); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(tempFile.Name())
+}
+
 // List lists objects in S3 with the given prefix
 func (c *Client) List(ctx context.Context, prefix string) ([]Object, error) {
 	// Apply client prefix to the search prefix
@@ -0,0 +1,153 @@
+// Package segment stores watch events between full snapshots. Each segment covers a
+// contiguous range of revisions and is named after it, so a chain of segments can be
+// found and verified from object names alone.
+package segment
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/thedataflows/etcd2s3/pkg/compression"
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+)
+
+// Prefix starts every segment file name
+const Prefix = "etcd-segment-"
+
+// Ref identifies a stored segment and the revisions it covers (inclusive)
+type Ref struct {
+	Name  string
+	Path  string
+	Start int64
+	End   int64
+}
+
+// Name returns the file name of a segment covering revisions start to end
+func Name(start, end int64) string {
+	return fmt.Sprintf("%s%020d-%020d%s", Prefix, start, end, etcd.ExportExt)
+}
+
+// Parse returns the revision range of a segment file name, compressed or not
+func Parse(filename string) (start, end int64, ok bool) {
+	name := filepath.Base(filename)
+	if compression.IsCompressed(name) {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if !strings.HasPrefix(name, Prefix) || !strings.HasSuffix(name, etcd.ExportExt) {
+		return 0, 0, false
+	}
+
+	bounds := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, Prefix), etcd.ExportExt), "-")
+	if len(bounds) != 2 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	end, err = strconv.ParseInt(bounds[1], 10, 64)
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// IsSegment reports whether a file name is a segment
+func IsSegment(filename string) bool {
+	_, _, ok := Parse(filename)
+	return ok
+}
+
+// NewRef builds a reference from a segment file name or S3 key
+func NewRef(path string) (Ref, bool) {
+	start, end, ok := Parse(path)
+	if !ok {
+		return Ref{}, false
+	}
+	return Ref{Name: filepath.Base(path), Path: path, Start: start, End: end}, true
+}
+
+// Chain orders segments and returns those needed to replay every change after revision
+// after, up to revision upTo (0 means as far as the segments go). Duplicates of the same
+// range (e.g. local and remote copies) are dropped, preferring the first one given.
+// It fails if a revision in between is not covered by any segment.
+func Chain(refs []Ref, after, upTo int64) ([]Ref, error) {
+	sorted := slices.Clone(refs)
+	slices.SortStableFunc(sorted, func(a, b Ref) int {
+		return cmp.Or(cmp.Compare(a.Start, b.Start), cmp.Compare(b.End, a.End))
+	})
+
+	var chain []Ref
+	next := after + 1
+	for _, ref := range sorted {
+		if upTo > 0 && next > upTo {
+			break
+		}
+		if ref.End < next {
+			// Already covered by the snapshot or a previous segment
+			continue
+		}
+		if ref.Start > next {
+			return nil, fmt.Errorf("no segment covers revisions %d to %d", next, ref.Start-1)
+		}
+		chain = append(chain, ref)
+		next = ref.End + 1
+	}
+
+	if upTo > 0 && next <= upTo {
+		return nil, fmt.Errorf("segments end at revision %d, revision %d was requested", next-1, upTo)
+	}
+	return chain, nil
+}
+
+// Write writes events to a new segment file
+func Write(path string, events []etcd.WatchEvent) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create segment: %w", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("failed to write segment: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write segment: %w", err)
+	}
+	return file.Close()
+}
+
+// Read calls fn with every event of an uncompressed segment file, in order
+func Read(path string, fn func(etcd.WatchEvent) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open segment: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var event etcd.WatchEvent
+		if err := decoder.Decode(&event); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to decode segment %s: %w", filepath.Base(path), err)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package segment
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+)
+
+func TestNameAndParse(t *testing.T) {
+	name := Name(12, 345)
+	assert.Equal(t, "etcd-segment-00000000000000000012-00000000000000000345.ndjson", name)
+
+	for _, filename := range []string{name, name + ".zst", "some/prefix/" + name + ".gz"} {
+		start, end, ok := Parse(filename)
+		require.True(t, ok, filename)
+		assert.Equal(t, int64(12), start)
+		assert.Equal(t, int64(345), end)
+	}
+
+	for _, filename := range []string{
+		"etcd-snapshot-20250101-000000.db.zst",
+		"etcd-export-20250101-000000.ndjson",
+		"etcd-segment-5-2.ndjson",
+		"etcd-segment-x-2.ndjson",
+	} {
+		assert.False(t, IsSegment(filename), filename)
+	}
+}
+
+func TestChain(tMain *testing.T) {
+	refs := func(ranges ...[2]int64) []Ref {
+		var result []Ref
+		for _, r := range ranges {
+			result = append(result, Ref{Name: Name(r[0], r[1]), Start: r[0], End: r[1]})
+		}
+		return result
+	}
+
+	tests := []struct {
+		name        string
+		refs        []Ref
+		after       int64
+		upTo        int64
+		expected    [][2]int64
+		expectError bool
+	}{
+		{
+			name:     "contiguous out of order",
+			refs:     refs([2]int64{21, 30}, [2]int64{11, 20}, [2]int64{31, 40}),
+			after:    10,
+			expected: [][2]int64{{11, 20}, {21, 30}, {31, 40}},
+		},
+		{
+			name:     "skips segments covered by the snapshot",
+			refs:     refs([2]int64{1, 10}, [2]int64{11, 20}, [2]int64{21, 30}),
+			after:    15,
+			expected: [][2]int64{{11, 20}, {21, 30}},
+		},
+		{
+			name:     "stops at the requested revision",
+			refs:     refs([2]int64{11, 20}, [2]int64{21, 30}, [2]int64{31, 40}),
+			after:    10,
+			upTo:     25,
+			expected: [][2]int64{{11, 20}, {21, 30}},
+		},
+		{
+			name:     "drops duplicates",
+			refs:     refs([2]int64{11, 20}, [2]int64{11, 20}, [2]int64{21, 30}),
+			after:    10,
+			expected: [][2]int64{{11, 20}, {21, 30}},
+		},
+		{
+			name:        "gap",
+			refs:        refs([2]int64{11, 20}, [2]int64{25, 30}),
+			after:       10,
+			expectError: true,
+		},
+		{
+			name:        "requested revision not recorded",
+			refs:        refs([2]int64{11, 20}),
+			after:       10,
+			upTo:        30,
+			expectError: true,
+		},
+		{
+			name:  "nothing after the snapshot",
+			refs:  refs([2]int64{1, 10}),
+			after: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		tMain.Run(tt.name, func(t *testing.T) {
+			chain, err := Chain(tt.refs, tt.after, tt.upTo)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var ranges [][2]int64
+			for _, ref := range chain {
+				ranges = append(ranges, [2]int64{ref.Start, ref.End})
+			}
+			assert.Equal(t, tt.expected, ranges)
+		})
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	events := []etcd.WatchEvent{
+		{Type: etcd.EventPut, KeyRecord: etcd.KeyRecord{Key: "/a", Value: []byte("1"), ModRevision: 2}, ObservedAt: now},
+		{Type: etcd.EventDelete, KeyRecord: etcd.KeyRecord{Key: "/b", ModRevision: 3}, ObservedAt: now},
+	}
+
+	path := filepath.Join(t.TempDir(), Name(2, 3))
+	require.NoError(t, Write(path, events))
+
+	var read []etcd.WatchEvent
+	require.NoError(t, Read(path, func(event etcd.WatchEvent) error {
+		read = append(read, event)
+		return nil
+	}))
+	require.Len(t, read, 2)
+	assert.Equal(t, "/a", read[0].Key)
+	assert.Equal(t, []byte("1"), read[0].Value)
+	assert.Equal(t, etcd.EventDelete, read[1].Type)
+	assert.True(t, now.Equal(read[1].ObservedAt))
+}
@@ -0,0 +1,235 @@
+// Package snapshotdb reads etcd snapshot files (bbolt databases) directly, without
+// restoring them into a data directory.
+package snapshotdb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/server/v3/storage/mvcc"
+	"go.etcd.io/etcd/server/v3/storage/schema"
+)
+
+// openTimeout bounds how long Open waits for a lock held by another process
+const openTimeout = 5 * time.Second
+
+// DB is a snapshot opened read-only
+type DB struct {
+	db *bolt.DB
+}
+
+// Meta holds the backend metadata stored in a snapshot
+type Meta struct {
+	ConsistentIndex uint64 `json:"consistent_index"`
+	Term            uint64 `json:"term"`
+	CompactRevision int64  `json:"compact_revision"`
+	ClusterVersion  string `json:"cluster_version,omitempty"`
+	StorageVersion  string `json:"storage_version,omitempty"`
+}
+
+// Member is a cluster member recorded in a snapshot
+type Member struct {
+	ID         uint64   `json:"id"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peerURLs"`
+	ClientURLs []string `json:"clientURLs,omitempty"`
+	IsLearner  bool     `json:"isLearner,omitempty"`
+}
+
+// Open opens an uncompressed snapshot file read-only
+func Open(path string) (*DB, error) {
+	db, err := bolt.Open(path, 0400, &bolt.Options{ReadOnly: true, Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot %s: %w", path, err)
+	}
+	return &DB{db: db}, nil
+}
+
+// Close closes the snapshot
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Size returns the size of the database file in bytes
+func (d *DB) Size() int64 {
+	var size int64
+	_ = d.db.View(func(tx *bolt.Tx) error {
+		size = tx.Size()
+		return nil
+	})
+	return size
+}
+
+// Meta reads the backend metadata
+func (d *DB) Meta() (*Meta, error) {
+	meta := &Meta{}
+	err := d.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(schema.Meta.Name()); bucket != nil {
+			if v := bucket.Get(schema.MetaConsistentIndexKeyName); len(v) == 8 {
+				meta.ConsistentIndex = binary.BigEndian.Uint64(v)
+			}
+			if v := bucket.Get(schema.MetaTermKeyName); len(v) == 8 {
+				meta.Term = binary.BigEndian.Uint64(v)
+			}
+			if v := bucket.Get(schema.FinishedCompactKeyName); len(v) >= 8 {
+				meta.CompactRevision = mvcc.BytesToRev(v).Main
+			}
+			meta.StorageVersion = string(bucket.Get(schema.MetaStorageVersionName))
+		}
+		if bucket := tx.Bucket(schema.Cluster.Name()); bucket != nil {
+			meta.ClusterVersion = string(bucket.Get(schema.ClusterClusterVersionKeyName))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// Members reads the cluster members
+func (d *DB) Members() ([]Member, error) {
+	var members []Member
+	err := d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(schema.Members.Name())
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var member Member
+			if err := json.Unmarshal(v, &member); err != nil {
+				return fmt.Errorf("failed to decode member %s: %w", k, err)
+			}
+			members = append(members, member)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot members: %w", err)
+	}
+	return members, nil
+}
+
+// KeyStat is the size and value hash of the latest version of a key, without its value
+type KeyStat struct {
+	Key string
+	// Size is the length of the key and the value
+	Size        int64
+	ModRevision int64
+	// Hash is the SHA-256 of the value, equal values have equal hashes
+	Hash [sha256.Size]byte
+}
+
+// NewKeyStat returns the stats of a key value
+func NewKeyStat(kv *mvccpb.KeyValue) KeyStat {
+	return KeyStat{Key: string(kv.Key), Size: int64(len(kv.Key) + len(kv.Value)), ModRevision: kv.ModRevision, Hash: sha256.Sum256(kv.Value)}
+}
+
+// LatestKeys returns the latest version of every live key accepted by match (nil accepts
+// all keys), sorted by key, and the revision of the snapshot. Every value is held in
+// memory, LatestKeyStats only keeps sizes and hashes.
+func (d *DB) LatestKeys(match func(key []byte) bool) ([]*mvccpb.KeyValue, int64, error) {
+	latest := make(map[string]*mvccpb.KeyValue)
+	revision, err := d.forEachKey(match, func(kv *mvccpb.KeyValue, tombstone bool) {
+		if tombstone {
+			delete(latest, string(kv.Key))
+		} else {
+			latest[string(kv.Key)] = kv
+		}
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	kvs := make([]*mvccpb.KeyValue, 0, len(latest))
+	for _, kv := range latest {
+		kvs = append(kvs, kv)
+	}
+	slices.SortFunc(kvs, func(a, b *mvccpb.KeyValue) int { return bytes.Compare(a.Key, b.Key) })
+
+	return kvs, revision, nil
+}
+
+// LatestKeyStats returns the size and value hash of the latest version of every live key accepted by
+// match (nil accepts all keys), sorted by key, and the revision of the snapshot. Values
+// are dropped as the snapshot is read, so memory grows with the number of keys only.
+func (d *DB) LatestKeyStats(match func(key []byte) bool) ([]KeyStat, int64, error) {
+	latest := make(map[string]KeyStat)
+	revision, err := d.forEachKey(match, func(kv *mvccpb.KeyValue, tombstone bool) {
+		if tombstone {
+			delete(latest, string(kv.Key))
+		} else {
+			latest[string(kv.Key)] = NewKeyStat(kv)
+		}
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	stats := make([]KeyStat, 0, len(latest))
+	for _, stat := range latest {
+		stats = append(stats, stat)
+	}
+	slices.SortFunc(stats, func(a, b KeyStat) int { return strings.Compare(a.Key, b.Key) })
+
+	return stats, revision, nil
+}
+
+// forEachKey calls fn with every revision of the keys accepted by match, oldest first,
+// and returns the revision of the snapshot
+func (d *DB) forEachKey(match func(key []byte) bool, fn func(kv *mvccpb.KeyValue, tombstone bool)) (int64, error) {
+	var revision int64
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(schema.Key.Name())
+		if bucket == nil {
+			return fmt.Errorf("snapshot has no key bucket")
+		}
+
+		// Revisions are stored in ascending order, the last one seen for a key wins
+		return bucket.ForEach(func(k, v []byte) error {
+			revision = max(revision, mvcc.BytesToRev(k).Main)
+
+			var kv mvccpb.KeyValue
+			if err := kv.Unmarshal(v); err != nil {
+				return fmt.Errorf("failed to decode key at revision %d: %w", mvcc.BytesToRev(k).Main, err)
+			}
+			if match != nil && !match(kv.Key) {
+				return nil
+			}
+
+			fn(&kv, mvcc.IsTombstone(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read snapshot keys: %w", err)
+	}
+	return revision, nil
+}
+
+// Prefix returns the first depth path segments of a key, including the trailing slash,
+// e.g. "/registry/pods/" for "/registry/pods/default/web" at depth 2. Keys with fewer
+// segments are returned whole.
+func Prefix(key string, depth int) string {
+	offset := 0
+	if strings.HasPrefix(key, "/") {
+		offset = 1
+	}
+	for range depth {
+		idx := strings.IndexByte(key[offset:], '/')
+		if idx < 0 {
+			return key
+		}
+		offset += idx + 1
+	}
+	return key[:offset]
+}
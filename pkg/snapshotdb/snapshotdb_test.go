@@ -0,0 +1,97 @@
+package snapshotdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thedataflows/etcd2s3/pkg/appconfig"
+	"github.com/thedataflows/etcd2s3/pkg/etcd"
+	"github.com/thedataflows/etcd2s3/pkg/etcd/etcdtest"
+)
+
+func TestDB(t *testing.T) {
+	srv := etcdtest.Start(t, etcdtest.Config{Name: "member-a"})
+	srv.PutKeys(t, map[string]string{
+		"/registry/pods/a": "old",
+		"/registry/pods/b": "b",
+		"/config/x":        "x",
+	})
+	srv.PutKeys(t, map[string]string{"/registry/pods/a": "new"})
+	_, err := srv.Client(t).Delete(context.Background(), "/registry/pods/b")
+	require.NoError(t, err)
+
+	client, err := etcd.NewClient(appconfig.EtcdConfig{Endpoints: []string{srv.Endpoint}})
+	require.NoError(t, err)
+	defer client.Close()
+
+	compacted, err := client.Compact(context.Background(), 2)
+	require.NoError(t, err)
+	current, err := client.Revision(context.Background())
+	require.NoError(t, err)
+
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.db")
+	_, err = client.Snapshot(context.Background(), snapshotPath)
+	require.NoError(t, err)
+
+	db, err := Open(snapshotPath)
+	require.NoError(t, err)
+	defer db.Close()
+
+	kvs, revision, err := db.LatestKeys(nil)
+	require.NoError(t, err)
+	assert.Equal(t, current, revision)
+	keys := make(map[string]string)
+	for _, kv := range kvs {
+		keys[string(kv.Key)] = string(kv.Value)
+	}
+	assert.Equal(t, map[string]string{"/config/x": "x", "/registry/pods/a": "new"}, keys)
+	assert.Equal(t, "/config/x", string(kvs[0].Key), "sorted by key")
+
+	filtered, _, err := db.LatestKeys(func(key []byte) bool { return string(key) == "/config/x" })
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+
+	stats, statsRevision, err := db.LatestKeyStats(nil)
+	require.NoError(t, err)
+	assert.Equal(t, current, statsRevision)
+	require.Len(t, stats, len(kvs))
+	for i, kv := range kvs {
+		assert.Equal(t, KeyStat{Key: string(kv.Key), Size: int64(len(kv.Key) + len(kv.Value)), ModRevision: kv.ModRevision, Hash: sha256.Sum256(kv.Value)}, stats[i])
+	}
+
+	meta, err := db.Meta()
+	require.NoError(t, err)
+	assert.Equal(t, compacted, meta.CompactRevision)
+	assert.Positive(t, meta.ConsistentIndex)
+	assert.Positive(t, meta.Term)
+
+	members, err := db.Members()
+	require.NoError(t, err)
+	require.Len(t, members, 1)
+	assert.Equal(t, "member-a", members[0].Name)
+	assert.Equal(t, []string{srv.PeerURL}, members[0].PeerURLs)
+
+	assert.Positive(t, db.Size())
+}
+
+func TestPrefix(t *testing.T) {
+	tests := []struct {
+		key      string
+		depth    int
+		expected string
+	}{
+		{key: "/registry/pods/default/web", depth: 2, expected: "/registry/pods/"},
+		{key: "/registry/pods/default/web", depth: 1, expected: "/registry/"},
+		{key: "/registry/pods", depth: 2, expected: "/registry/pods"},
+		{key: "app/a/b", depth: 1, expected: "app/"},
+		{key: "/top", depth: 0, expected: "/"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, Prefix(tt.key, tt.depth), "%s at depth %d", tt.key, tt.depth)
+	}
+}